@@ -139,6 +139,10 @@ func init() {
 
 func runBuild(args []string, mode mode, modeArgs []string) {
 	workspaceRoot := util.GetWorkspaceRoot()
+	// The workspace is only locked while the build files are generated, so that long-running targets
+	// (e.g., of 'dbt run') neither block other builds nor 'dbt sync'.
+	lock := util.LockWorkspace(workspaceRoot)
+
 	dbtRulesDir := path.Join(workspaceRoot, util.DepsDirName, dbtRulesDirName)
 	if !util.DirExists(dbtRulesDir) {
 		log.Fatal("You are running 'dbt build' without '%s' being available. Add that dependency, run 'dbt sync' and try again.\n", dbtRulesDirName)
@@ -217,6 +221,7 @@ func runBuild(args []string, mode mode, modeArgs []string) {
 	ninjaFilePath := path.Join(genInput.OutputDir, ninjaFileName)
 	log.Debug("Ninja file: %s.\n", ninjaFilePath)
 	util.WriteFile(ninjaFilePath, []byte(genOutput.NinjaFile))
+	lock.Unlock()
 
 	// Print all available targets and flags if there is nothing to build.
 	if mode == modeList {
@@ -463,6 +468,7 @@ func runGenerator(input generatorInput) generatorOutput {
 
 	cmd := exec.Command("go", "run", mainFileName)
 	cmd.Dir = generatorDir
+	cmd.Env = config.GoEnvironment()
 	if !input.CompletionsOnly {
 		cmd.Stderr = os.Stderr
 		cmd.Stdout = os.Stdout
@@ -622,6 +628,7 @@ func createSumGoFile(generatorDir string) {
 	var stdout, stderr bytes.Buffer
 	cmd := exec.Command("go", "mod", "download")
 	cmd.Dir = generatorDir
+	cmd.Env = config.GoEnvironment()
 	cmd.Stderr = &stderr
 	cmd.Stdout = &stdout
 	err := cmd.Run()
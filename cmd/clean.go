@@ -25,6 +25,10 @@ func init() {
 func runClean(cmd *cobra.Command, args []string) {
 	workspaceRoot := util.GetModuleRoot()
 	log.Debug("Workspace: %s.\n", workspaceRoot)
+
+	lock := util.LockWorkspace(workspaceRoot)
+	defer lock.Unlock()
+
 	buildDir := path.Join(workspaceRoot, util.BuildDirName)
 	log.Debug("Removing %s diectory '%s'.\n", util.BuildDirName, buildDir)
 	os.RemoveAll(buildDir)
@@ -49,8 +49,13 @@ func runClone(cmd *cobra.Command, args []string) {
 		return
 	}
 
+	cloneMode, err := module.GetCloneMode("")
+	if err != nil {
+		log.Fatal("Invalid configuration: %s.\n", err)
+	}
+
 	log.Log("Cloning '%s' into '%s'.\n", repoUrl, repoPath)
-	mod, err := module.CreateGitModule(repoPath, repoUrl)
+	mod, err := module.CreateGitModule(repoPath, repoUrl, cloneMode, nil)
 	if err != nil {
 		os.RemoveAll(repoPath)
 		log.Fatal("Failed to create git module: %s.\n", err)
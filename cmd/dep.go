@@ -2,7 +2,9 @@ package cmd
 
 import (
 	"path"
+	"path/filepath"
 	"regexp"
+	"strings"
 
 	"github.com/daedaleanai/cobra"
 	"github.com/daedaleanai/dbt/v3/log"
@@ -12,8 +14,10 @@ import (
 
 var (
 	nameRegexp    = regexp.MustCompile(`^[a-z0-9_\-.]+$`)
-	urlRegexp     = regexp.MustCompile(`/([A-Za-z0-9_\-.]+)(\.git|\.tar\.gz)$`)
+	urlRegexp     = regexp.MustCompile(`/([A-Za-z0-9_\-.{}]+?)(\.git|\.tar\.gz|\.zip|\.tar\.xz|\.tar\.bz2|\.tar\.zst)$`)
 	versionRegexp = regexp.MustCompile(`^[A-Za-z0-9_\-./]+$`)
+	// Local directories are referenced by absolute paths or file:// URLs.
+	localUrlRegexp = regexp.MustCompile(`^(file://)?/(.*/)?([A-Za-z0-9_\-.]+)/?$`)
 )
 
 const masterVersion = "origin/master"
@@ -25,7 +29,7 @@ var (
 	}
 
 	addCmd = &cobra.Command{
-		Use:               "add [NAME] --url=URL [--version=VERSION]",
+		Use:               "add [NAME] --url=URL [--version=VERSION] [--subdir=SUBDIR] [--clone=MODE]",
 		Args:              cobra.RangeArgs(0, 1),
 		Short:             "Adds a dependency to the MODULE file of the current module",
 		Long:              `Adds a dependency to the MODULE file of the current module.`,
@@ -41,9 +45,23 @@ var (
 		Run:               runRemove,
 		ValidArgsFunction: completeDepArgs,
 	}
+
+	overrideCmd = &cobra.Command{
+		Use:   "override [NAME] [--path=PATH | --remove]",
+		Args:  cobra.RangeArgs(0, 1),
+		Short: "Overrides a dependency of the workspace with a local directory",
+		Long: `Overrides a dependency of the workspace with a local directory.
+'dbt sync' symlinks DEPS/NAME to the directory instead of cloning the dependency and never pins its hash.
+Overrides are stored in the MODULE.local file of the workspace, which should not be committed.
+Without arguments, all overrides are listed.`,
+		Run:               runOverride,
+		ValidArgsFunction: completeOverrideArgs,
+	}
 )
 
-var url, version string
+var url, version, subdir, cloneMode string
+var overridePath string
+var overrideRemove bool
 
 func init() {
 	rootCmd.AddCommand(depCmd)
@@ -51,8 +69,14 @@ func init() {
 	depCmd.AddCommand(addCmd)
 	addCmd.Flags().StringVar(&url, "url", "", "Dependency URL")
 	addCmd.Flags().StringVar(&version, "version", masterVersion, "Dependency version")
+	addCmd.Flags().StringVar(&subdir, "subdir", "", "Subdirectory of the git repository that contains the module")
+	addCmd.Flags().StringVar(&cloneMode, "clone", "", "How the git repository is cloned ('full', 'shallow' or 'blobless')")
 
 	depCmd.AddCommand(removeCmd)
+
+	depCmd.AddCommand(overrideCmd)
+	overrideCmd.Flags().StringVar(&overridePath, "path", "", "Local directory that replaces the dependency")
+	overrideCmd.Flags().BoolVar(&overrideRemove, "remove", false, "Remove the override")
 }
 
 func runAdd(cmd *cobra.Command, args []string) {
@@ -65,22 +89,55 @@ func runAdd(cmd *cobra.Command, args []string) {
 	var name string
 	if len(args) == 0 {
 		checkUrl(url)
-		name = urlRegexp.FindStringSubmatch(url)[1]
+		if subdir != "" {
+			// Subdirectory modules are named after their subdirectory by default.
+			name = path.Base(subdir)
+		} else if match := urlRegexp.FindStringSubmatch(url); match != nil {
+			// The version is not part of the name of versioned archives (e.g., 'lib-{version}.tar.gz').
+			name = strings.Trim(strings.ReplaceAll(match[1], module.VersionPlaceholder, ""), "-_.")
+		} else {
+			name = localUrlRegexp.FindStringSubmatch(url)[3]
+		}
 	} else {
 		name = args[0]
 	}
 	checkName(name)
 
 	dep, exists := moduleFile.Dependencies[name]
+	previousVersion := dep.Version
 	if url != "" {
 		dep.URL = url
 	}
 	if version != "" {
 		dep.Version = version
 	}
+	if cmd.Flags().Changed("subdir") {
+		dep.Subdir = subdir
+	}
+	if cmd.Flags().Changed("clone") {
+		if _, err := module.GetCloneMode(cloneMode); err != nil {
+			log.Fatal("Invalid --clone flag: %s.\n", err)
+		}
+		dep.Clone = cloneMode
+	}
 
 	checkUrl(dep.URL)
 	checkVersion(dep.Version)
+	if dep.IsVersioned() {
+		if !module.DetermineModuleType(dep.URL, dep.Type).IsArchive() {
+			log.Fatal("Only archive URLs can contain the '%s' placeholder.\n", module.VersionPlaceholder)
+		}
+		if !cmd.Flags().Changed("version") {
+			if !exists {
+				log.Fatal("A --version is required for URLs that contain the '%s' placeholder.\n", module.VersionPlaceholder)
+			}
+			dep.Version = previousVersion
+		}
+		// Each version of an archive has a different hash, which is resolved by the next sync.
+		if dep.Version != previousVersion {
+			dep.Hash = ""
+		}
+	}
 
 	moduleFile.Dependencies[name] = dep
 	module.WriteModuleFile(moduleRoot, moduleFile)
@@ -113,6 +170,69 @@ func runRemove(cmd *cobra.Command, args []string) {
 	log.Success("Removed dependency '%s' from module '%s'.\n", name, moduleName)
 }
 
+func runOverride(cmd *cobra.Command, args []string) {
+	workspaceRoot := util.GetWorkspaceRoot()
+	lock := util.LockWorkspace(workspaceRoot)
+	defer lock.Unlock()
+	localModuleFile := module.ReadLocalModuleFile(workspaceRoot)
+
+	if len(args) == 0 {
+		if overridePath != "" || overrideRemove {
+			log.Fatal("A dependency name is required.\n")
+		}
+		if len(localModuleFile.Overrides) == 0 {
+			log.Log("No dependencies are overridden.\n")
+		}
+		for _, entry := range util.OrderedEntries(localModuleFile.Overrides) {
+			log.Log("%s -> %s\n", entry.Key, entry.Value)
+		}
+		return
+	}
+
+	name := args[0]
+	checkName(name)
+
+	if overrideRemove {
+		if overridePath != "" {
+			log.Fatal("--path and --remove cannot be used together.\n")
+		}
+		if _, exists := localModuleFile.Overrides[name]; !exists {
+			log.Warning("Dependency '%s' is not overridden.\n", name)
+			return
+		}
+		delete(localModuleFile.Overrides, name)
+		module.WriteLocalModuleFile(workspaceRoot, localModuleFile)
+		log.Success("Removed override of dependency '%s'. Run 'dbt sync' to check out the pinned hash again.\n", name)
+		return
+	}
+
+	if overridePath == "" {
+		log.Fatal("Either --path or --remove is required.\n")
+	}
+	localPath, err := filepath.Abs(overridePath)
+	if err != nil {
+		log.Fatal("Failed to determine absolute path of '%s': %s.\n", overridePath, err)
+	}
+	if !util.DirExists(localPath) || !module.IsModule(localPath) {
+		log.Fatal("'%s' is not a module checkout.\n", localPath)
+	}
+
+	localModuleFile.Overrides[name] = localPath
+	module.WriteLocalModuleFile(workspaceRoot, localModuleFile)
+
+	// Replace a module that has already been synced right away, so that the override applies to all commands.
+	depModulePath := path.Join(workspaceRoot, util.DepsDirName, name)
+	if util.DirExists(depModulePath) || module.IsSymlink(depModulePath) {
+		if err := module.LinkOverride(depModulePath, localPath); err != nil {
+			log.Warning("Failed to replace module '%s': %s.\n", name, err)
+		} else {
+			log.Success("Overrode dependency '%s' with '%s'.\n", name, localPath)
+			return
+		}
+	}
+	log.Success("Overrode dependency '%s' with '%s'. Run 'dbt sync' to apply the override.\n", name, localPath)
+}
+
 func checkName(name string) {
 	if !nameRegexp.MatchString(name) {
 		log.Fatal("Module name '%s' does not match the expected format.\n", url)
@@ -120,7 +240,7 @@ func checkName(name string) {
 }
 
 func checkUrl(url string) {
-	if !urlRegexp.MatchString(url) {
+	if !urlRegexp.MatchString(url) && !localUrlRegexp.MatchString(url) {
 		log.Fatal("URL '%s' does not match the expected format.\n", url)
 	}
 }
@@ -142,3 +262,13 @@ func completeDepArgs(cmd *cobra.Command, args []string, toComplete string) ([]st
 	}
 	return completions, cobra.ShellCompDirectiveNoFileComp
 }
+
+func completeOverrideArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	completions := []string{}
+	if len(args) == 0 {
+		workspaceRoot := util.GetWorkspaceRoot()
+		modules := module.GetAllModules(workspaceRoot)
+		completions = append(completions, modules.Keys()...)
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
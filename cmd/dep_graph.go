@@ -0,0 +1,309 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/daedaleanai/cobra"
+	"github.com/daedaleanai/dbt/v3/log"
+	"github.com/daedaleanai/dbt/v3/module"
+	"github.com/daedaleanai/dbt/v3/util"
+)
+
+const (
+	graphFormatText = "text"
+	graphFormatJson = "json"
+	graphFormatDot  = "dot"
+)
+
+var (
+	treeCmd = &cobra.Command{
+		Use:   "tree [--format=text|json|dot]",
+		Args:  cobra.NoArgs,
+		Short: "Prints the dependency graph of the workspace",
+		Long: `Prints the transitive dependency graph of the workspace, starting from the top-level MODULE file.
+Each edge lists the version string and hash required by the module that introduced it.
+Each module lists the hash that is currently checked out in the DEPS/ directory.`,
+		Run: runTree,
+	}
+
+	whyCmd = &cobra.Command{
+		Use:               "why NAME [--format=text|json|dot]",
+		Args:              cobra.ExactArgs(1),
+		Short:             "Prints all paths from the workspace to a dependency",
+		Long:              `Prints all paths through the dependency graph from the top-level module to a dependency.`,
+		Run:               runWhy,
+		ValidArgsFunction: completeGraphArgs,
+	}
+)
+
+var graphFormat string
+
+func init() {
+	depCmd.AddCommand(treeCmd)
+	treeCmd.Flags().StringVar(&graphFormat, "format", graphFormatText, "Output format: text, json or dot")
+
+	depCmd.AddCommand(whyCmd)
+	whyCmd.Flags().StringVar(&graphFormat, "format", graphFormatText, "Output format: text, json or dot")
+}
+
+// depGraph is the dependency graph as it is walked by 'dbt sync'.
+type depGraph struct {
+	Root    string           `json:"root"`
+	Modules []depGraphModule `json:"modules"`
+	Edges   []depGraphEdge   `json:"edges"`
+}
+
+type depGraphModule struct {
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+	Type string `json:"type,omitempty"`
+	// Hash currently checked out in the DEPS/ directory (empty if the module has not been synced yet).
+	Hash     string `json:"hash,omitempty"`
+	Override string `json:"override,omitempty"`
+}
+
+// depGraphEdge is a dependency declared in the MODULE file of module `From`.
+type depGraphEdge struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Version string `json:"version"`
+	Hash    string `json:"hash,omitempty"`
+}
+
+func runTree(cmd *cobra.Command, args []string) {
+	checkGraphFormat()
+	graph := buildDepGraph(util.GetWorkspaceRoot())
+
+	switch graphFormat {
+	case graphFormatJson:
+		printJson(graph)
+	case graphFormatDot:
+		printDot(graph, graph.Edges)
+	default:
+		graph.printTree()
+	}
+}
+
+func runWhy(cmd *cobra.Command, args []string) {
+	checkGraphFormat()
+	graph := buildDepGraph(util.GetWorkspaceRoot())
+	name := args[0]
+
+	if _, exists := graph.module(name); !exists {
+		log.Fatal("The workspace does not depend on module '%s'.\n", name)
+	}
+	paths := graph.paths(name)
+
+	switch graphFormat {
+	case graphFormatJson:
+		printJson(struct {
+			Module string     `json:"module"`
+			Paths  [][]string `json:"paths"`
+		}{name, paths})
+	case graphFormatDot:
+		onPath := map[[2]string]bool{}
+		for _, p := range paths {
+			for idx := 1; idx < len(p); idx++ {
+				onPath[[2]string{p[idx-1], p[idx]}] = true
+			}
+		}
+		edges := []depGraphEdge{}
+		for _, edge := range graph.Edges {
+			if onPath[[2]string{edge.From, edge.To}] {
+				edges = append(edges, edge)
+			}
+		}
+		printDot(graph, edges)
+	default:
+		for _, p := range paths {
+			fmt.Println(formatChain(p))
+		}
+	}
+}
+
+func checkGraphFormat() {
+	switch graphFormat {
+	case graphFormatText, graphFormatJson, graphFormatDot:
+	default:
+		log.Fatal("Unknown format '%s'. Use 'text', 'json' or 'dot'.\n", graphFormat)
+	}
+}
+
+// buildDepGraph walks the dependency graph in the same order as 'dbt sync', reading the MODULE files
+// of all dependencies from the DEPS/ directory.
+func buildDepGraph(workspaceRoot string) depGraph {
+	workspaceModuleName := module.OpenModule(workspaceRoot).Name()
+	overrides := module.GetOverrides(workspaceRoot)
+	graph := depGraph{
+		Root:    workspaceModuleName,
+		Modules: []depGraphModule{{Name: workspaceModuleName}},
+		Edges:   []depGraphEdge{},
+	}
+
+	visited := map[string]bool{workspaceModuleName: true}
+	queue := []string{workspaceRoot}
+	for len(queue) > 0 {
+		modulePath := queue[0]
+		queue = queue[1:]
+
+		moduleName := path.Base(modulePath)
+		if modulePath == workspaceRoot {
+			moduleName = workspaceModuleName
+		}
+
+		moduleFile := module.ReadModuleFile(modulePath)
+		for _, name := range dependencyNames(moduleFile) {
+			dep := moduleFile.Dependencies[name]
+			graph.Edges = append(graph.Edges, depGraphEdge{
+				From:    moduleName,
+				To:      name,
+				Version: dep.Version,
+				Hash:    dep.Hash,
+			})
+			if visited[name] {
+				continue
+			}
+			visited[name] = true
+
+			depModulePath := path.Join(workspaceRoot, util.DepsDirName, name)
+			graphModule := depGraphModule{
+				Name:     name,
+				URL:      dep.URL,
+				Type:     module.DetermineModuleType(dep.URL, dep.Type).String(),
+				Override: overrides[name],
+			}
+			if util.DirExists(depModulePath) && module.IsModule(depModulePath) {
+				graphModule.Hash = module.OpenModule(depModulePath).Head()
+				queue = append(queue, depModulePath)
+			}
+			graph.Modules = append(graph.Modules, graphModule)
+		}
+	}
+	return graph
+}
+
+func (g depGraph) module(name string) (depGraphModule, bool) {
+	for _, mod := range g.Modules {
+		if mod.Name == name {
+			return mod, true
+		}
+	}
+	return depGraphModule{}, false
+}
+
+func (g depGraph) dependencies(name string) []depGraphEdge {
+	edges := []depGraphEdge{}
+	for _, edge := range g.Edges {
+		if edge.From == name {
+			edges = append(edges, edge)
+		}
+	}
+	return edges
+}
+
+// paths returns all paths from the root of the graph to module `name`.
+func (g depGraph) paths(name string) [][]string {
+	paths := [][]string{}
+	onPath := map[string]bool{}
+	var walk func(current []string)
+	walk = func(current []string) {
+		last := current[len(current)-1]
+		if last == name {
+			paths = append(paths, current)
+			return
+		}
+		onPath[last] = true
+		for _, edge := range g.dependencies(last) {
+			if !onPath[edge.To] {
+				walk(extendChain(current, edge.To))
+			}
+		}
+		onPath[last] = false
+	}
+	walk([]string{g.Root})
+	return paths
+}
+
+// printTree prints the graph as a tree. The dependencies of modules that appear more than once
+// are only printed for the first occurrence.
+func (g depGraph) printTree() {
+	fmt.Println(g.Root)
+	printed := map[string]bool{g.Root: true}
+	var walk func(name, prefix string)
+	walk = func(name, prefix string) {
+		edges := g.dependencies(name)
+		for idx, edge := range edges {
+			branch, indent := "├── ", "│   "
+			if idx == len(edges)-1 {
+				branch, indent = "└── ", "    "
+			}
+			fmt.Printf("%s%s%s %s\n", prefix, branch, edge.To, g.describeEdge(edge, printed[edge.To]))
+			if !printed[edge.To] {
+				printed[edge.To] = true
+				walk(edge.To, prefix+indent)
+			}
+		}
+	}
+	walk(g.Root, "")
+}
+
+func (g depGraph) describeEdge(edge depGraphEdge, repeated bool) string {
+	mod, _ := g.module(edge.To)
+	details := []string{edge.Version}
+	if edge.Hash != "" {
+		details = append(details, shortHash(edge.Hash))
+	}
+	description := fmt.Sprintf("(%s)", strings.Join(details, " @ "))
+
+	switch {
+	case mod.Override != "":
+		description += fmt.Sprintf(" [overridden by '%s']", mod.Override)
+	case mod.Hash == "":
+		description += " [not synced]"
+	case edge.Hash != "" && mod.Hash != edge.Hash:
+		description += fmt.Sprintf(" [checked out at %s]", shortHash(mod.Hash))
+	}
+	if repeated {
+		description += " (*)"
+	}
+	return description
+}
+
+func printJson(v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		log.Fatal("Failed to marshal JSON: %s.\n", err)
+	}
+	fmt.Println(string(data))
+}
+
+// printDot prints `edges` of the graph in the Graphviz DOT language.
+func printDot(graph depGraph, edges []depGraphEdge) {
+	fmt.Println("digraph dependencies {")
+	for _, edge := range edges {
+		label := edge.Version
+		if edge.Hash != "" {
+			label += `\n` + shortHash(edge.Hash)
+		}
+		fmt.Printf("  \"%s\" -> \"%s\" [label=\"%s\"];\n", edge.From, edge.To, label)
+	}
+	for _, mod := range graph.Modules {
+		if mod.Override != "" {
+			fmt.Printf("  \"%s\" [style=dashed];\n", mod.Name)
+		}
+	}
+	fmt.Println("}")
+}
+
+func completeGraphArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	completions := []string{}
+	if len(args) == 0 {
+		for _, mod := range buildDepGraph(util.GetWorkspaceRoot()).Modules {
+			completions = append(completions, mod.Name)
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
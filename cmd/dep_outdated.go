@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"path"
+
+	"github.com/daedaleanai/cobra"
+	"github.com/daedaleanai/dbt/v3/log"
+	"github.com/daedaleanai/dbt/v3/module"
+	"github.com/daedaleanai/dbt/v3/util"
+)
+
+var outdatedCmd = &cobra.Command{
+	Use:   "outdated [--json]",
+	Args:  cobra.NoArgs,
+	Short: "Lists dependencies whose hashes lag behind their version strings",
+	Long: `Fetches all dependencies in the DEPS/ directory and lists how many commits the checked out hash
+of each dependency lags behind the commit its version string currently resolves to.`,
+	Run: runOutdated,
+}
+
+var outdatedJson bool
+
+func init() {
+	depCmd.AddCommand(outdatedCmd)
+	outdatedCmd.Flags().BoolVar(&outdatedJson, "json", false, "Print the report as JSON.")
+}
+
+type outdatedModule struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Current string `json:"current"`
+	Latest  string `json:"latest"`
+	// Number of commits between the current and the latest hash (-1 if it could not be determined).
+	Behind   int  `json:"behind"`
+	Outdated bool `json:"outdated"`
+}
+
+func runOutdated(cmd *cobra.Command, args []string) {
+	workspaceRoot := util.GetWorkspaceRoot()
+
+	// Modules in the DEPS/ directory are fetched.
+	lock := util.LockWorkspace(workspaceRoot)
+	defer lock.Unlock()
+	graph := buildDepGraph(workspaceRoot)
+
+	// Use the version string of the first module that depends on each module, like 'dbt sync' does.
+	versions := map[string]string{}
+	for _, edge := range graph.Edges {
+		if _, exists := versions[edge.To]; !exists {
+			versions[edge.To] = edge.Version
+		}
+	}
+
+	report := []outdatedModule{}
+	for _, mod := range graph.Modules {
+		if mod.Name == graph.Root || mod.Hash == "" {
+			continue
+		}
+		if mod.Override != "" {
+			log.Debug("Skipping module '%s', which is overridden by '%s'.\n", mod.Name, mod.Override)
+			continue
+		}
+
+		log.Debug("Fetching module '%s'.\n", mod.Name)
+		depModule := module.OpenModule(path.Join(workspaceRoot, util.DepsDirName, mod.Name))
+		if _, err := depModule.Fetch(); err != nil {
+			log.Fatal("Failed to fetch module '%s': %s.\n", mod.Name, err)
+		}
+
+		entry := outdatedModule{
+			Name:    mod.Name,
+			Version: versions[mod.Name],
+			Current: depModule.Head(),
+			Latest:  depModule.RevParse(versions[mod.Name]),
+		}
+		entry.Outdated = entry.Current != entry.Latest
+		if gitModule, isGit := depModule.(module.GitModule); isGit {
+			commits, err := gitModule.GetCommitsBetweenRefs(entry.Current, entry.Latest)
+			entry.Behind = len(commits)
+			if err != nil {
+				log.Warning("Failed to list commits of module '%s': %s.\n", mod.Name, err)
+				entry.Behind = -1
+			}
+		} else if entry.Outdated {
+			entry.Behind = -1
+		}
+		report = append(report, entry)
+	}
+
+	if outdatedJson {
+		printJson(report)
+		return
+	}
+
+	log.IndentationLevel = 0
+	outdated := 0
+	for _, entry := range report {
+		if !entry.Outdated {
+			log.Debug("%s: up to date at '%s' (%s)\n", entry.Name, shortHash(entry.Current), entry.Version)
+			continue
+		}
+		outdated++
+		if entry.Behind < 0 {
+			log.Log("%s: '%s' -> '%s' (%s)\n", entry.Name, shortHash(entry.Current), shortHash(entry.Latest), entry.Version)
+		} else {
+			log.Log("%s: %d commit(s) behind, '%s' -> '%s' (%s)\n", entry.Name, entry.Behind, shortHash(entry.Current), shortHash(entry.Latest), entry.Version)
+		}
+	}
+	if outdated == 0 {
+		log.Success("All dependencies are up to date.\n")
+	}
+}
@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	"github.com/daedaleanai/cobra"
+	"github.com/daedaleanai/dbt/v3/log"
+	"github.com/daedaleanai/dbt/v3/module"
+	"github.com/daedaleanai/dbt/v3/util"
+)
+
+var depUpdateCmd = &cobra.Command{
+	Use:   "update [NAMES...]",
+	Short: "Updates the hashes of dependencies of the top-level module and syncs the workspace",
+	Long: `Fetches the named dependencies of the top-level module and resolves their version strings to new hashes.
+The new hashes are written to the top-level MODULE file before the workspace is synced.
+Without arguments, all dependencies of the top-level module are updated.`,
+	Run:               runDepUpdate,
+	ValidArgsFunction: completeWorkspaceDepArgs,
+}
+
+func init() {
+	depCmd.AddCommand(depUpdateCmd)
+}
+
+func runDepUpdate(cmd *cobra.Command, args []string) {
+	workspaceRoot := util.GetWorkspaceRoot()
+	log.Debug("Workspace: %s.\n", workspaceRoot)
+
+	// Modules in the DEPS/ directory are fetched.
+	lock := util.LockWorkspace(workspaceRoot)
+	defer lock.Unlock()
+
+	workspaceModuleFile := module.ReadModuleFile(workspaceRoot)
+	overrides := module.GetOverrides(workspaceRoot)
+
+	names := args
+	if len(names) == 0 {
+		names = util.OrderedKeys(workspaceModuleFile.Dependencies)
+	}
+	for _, name := range names {
+		if _, exists := workspaceModuleFile.Dependencies[name]; !exists {
+			log.Fatal("Module '%s' is not a dependency of the top-level module.\n", name)
+		}
+	}
+
+	moduleFilePath := path.Join(workspaceRoot, util.ModuleFileName)
+	originalModuleFile := util.ReadFile(moduleFilePath)
+
+	updated := false
+	for _, name := range names {
+		log.IndentationLevel = 0
+		log.Log("Updating %s\n", name)
+		log.IndentationLevel = 1
+
+		dep := workspaceModuleFile.Dependencies[name]
+		depModulePath := path.Join(workspaceRoot, util.DepsDirName, name)
+		if _, overridden := overrides[name]; overridden {
+			log.Warning("Module is overridden in %s. Not updating it.\n\n", util.LocalModuleFileName)
+			continue
+		}
+		if !util.DirExists(depModulePath) || (module.IsSymlink(depModulePath) && !module.IsSubdirLink(depModulePath)) {
+			log.Log("Module has not been synced yet. Its hash will be resolved by the sync.\n\n")
+			dep.Hash = ""
+			workspaceModuleFile.Dependencies[name] = dep
+			updated = true
+			continue
+		}
+
+		depModule := module.OpenModule(depModulePath)
+		if dep.IsVersioned() && depModule.Type().IsArchive() {
+			if depModule.URL() == dep.ResolvedURL() {
+				log.Log("Already up to date at '%s' (%s).\n\n", shortHash(depModule.Head()), dep.Version)
+				continue
+			}
+			// The hash of the new version is only known once the sync has downloaded it.
+			log.Log("'%s' -> '%s'. Its hash will be resolved by the sync.\n\n", depModule.URL(), dep.ResolvedURL())
+			dep.Hash = ""
+			workspaceModuleFile.Dependencies[name] = dep
+			updated = true
+			continue
+		}
+		if _, err := depModule.Fetch(); err != nil {
+			log.Fatal("Failed to fetch module '%s': %s.\n", name, err)
+		}
+		newHash := depModule.RevParse(dep.Version)
+		if newHash == dep.Hash {
+			log.Log("Already up to date at '%s' (%s).\n\n", shortHash(newHash), dep.Version)
+			continue
+		}
+
+		log.Log("%s..%s (%s)\n", shortHash(dep.Hash), shortHash(newHash), dep.Version)
+		printCommitRange(depModule, dep.Hash, newHash)
+		log.Log("\n")
+
+		dep.Hash = newHash
+		workspaceModuleFile.Dependencies[name] = dep
+		updated = true
+	}
+	log.IndentationLevel = 0
+
+	if !updated {
+		log.Success("All dependencies are up to date.\n")
+		return
+	}
+
+	// The sync only rolls back to the updated MODULE file, so restore the original one as well.
+	unregister := log.OnFatal(func() {
+		if err := os.WriteFile(moduleFilePath, originalModuleFile, 0664); err != nil {
+			log.Error("Failed to restore '%s': %s.\n", moduleFilePath, err)
+		}
+	})
+	module.WriteModuleFile(workspaceRoot, workspaceModuleFile)
+	syncWorkspace(workspaceRoot)
+	unregister()
+}
+
+// printCommitRange lists the commits of a git module between `oldHash` and `newHash`.
+func printCommitRange(depModule module.Module, oldHash, newHash string) {
+	gitModule, isGit := depModule.(module.GitModule)
+	if !isGit || oldHash == "" {
+		return
+	}
+
+	commits, err := gitModule.GetCommitsBetweenRefs(oldHash, newHash)
+	if err != nil {
+		log.Warning("Failed to list commits between '%s' and '%s': %s.\n", shortHash(oldHash), shortHash(newHash), err)
+		return
+	}
+	if !gitModule.IsAncestor(oldHash, newHash) {
+		log.Warning("The new hash does not descend from the old hash.\n")
+	}
+	log.Log("%d new commit(s):\n", len(commits))
+	log.IndentationLevel = 2
+	for _, commit := range commits {
+		title, _ := gitModule.GetCommitTitle(commit)
+		log.Log("%s %s\n", shortHash(commit), strings.Trim(title, "\""))
+	}
+	log.IndentationLevel = 1
+}
+
+func completeWorkspaceDepArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	workspaceModuleFile := module.ReadModuleFile(util.GetWorkspaceRoot())
+	return util.OrderedKeys(workspaceModuleFile.Dependencies), cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+)
+
+// Tests run dbt commands in a separate process of the test binary, since dbt exits on fatal errors.
+// The arguments of the command are passed in this environment variable.
+const testArgsVariable = "DBT_TEST_ARGS"
+
+func TestMain(m *testing.M) {
+	if data, ok := os.LookupEnv(testArgsVariable); ok {
+		var args []string
+		if err := json.Unmarshal([]byte(data), &args); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid %s: %s\n", testArgsVariable, err)
+			os.Exit(2)
+		}
+		rootCmd.SetArgs(args)
+		if rootCmd.Execute() != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// testEnvironment is a temporary directory that contains git repositories, which serve as the remotes
+// of modules, and the dbt configuration that is used by all dbt commands of a test.
+type testEnvironment struct {
+	t   *testing.T
+	dir string
+}
+
+func newTestEnvironment(t *testing.T) *testEnvironment {
+	e := &testEnvironment{t: t, dir: t.TempDir()}
+	e.writeConfig("mirror: %s\nretries: 0\n", e.path("mirror"))
+	return e
+}
+
+func (e *testEnvironment) path(elements ...string) string {
+	return path.Join(append([]string{e.dir}, elements...)...)
+}
+
+// writeConfig writes the dbt configuration file.
+func (e *testEnvironment) writeConfig(format string, a ...interface{}) {
+	e.writeFile(e.path("config", "config.yaml"), fmt.Sprintf(format, a...))
+}
+
+func (e *testEnvironment) writeFile(filePath, content string) {
+	e.t.Helper()
+	if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+		e.t.Fatal(err)
+	}
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		e.t.Fatal(err)
+	}
+}
+
+func (e *testEnvironment) readFile(filePath string) string {
+	e.t.Helper()
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	return string(data)
+}
+
+// git runs a git command in `dir` and returns its trimmed output.
+func (e *testEnvironment) git(dir string, args ...string) string {
+	e.t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=dbt", "GIT_AUTHOR_EMAIL=dbt@example.com",
+		"GIT_COMMITTER_NAME=dbt", "GIT_COMMITTER_EMAIL=dbt@example.com")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		e.t.Fatalf("git %s failed in '%s': %s\n%s", strings.Join(args, " "), dir, err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// url returns the url of the remote repository `name`.
+func (e *testEnvironment) url(name string) string {
+	return "file://" + e.path("remotes", name+".git")
+}
+
+// createRepo creates the remote repository `name` with a MODULE file that has the content `moduleFile`
+// and returns the hash of its commit.
+func (e *testEnvironment) createRepo(name, moduleFile string) string {
+	e.t.Helper()
+	workDir := e.path("src", name)
+	e.writeFile(path.Join(workDir, "MODULE"), moduleFile)
+	e.git(workDir, "init", "-q", "-b", "master")
+	e.git(workDir, "add", "-A")
+	e.git(workDir, "commit", "-q", "-m", "Create "+name)
+	e.git(e.dir, "clone", "-q", "--bare", workDir, e.path("remotes", name+".git"))
+	e.git(workDir, "remote", "add", "origin", e.path("remotes", name+".git"))
+	return e.git(workDir, "rev-parse", "HEAD")
+}
+
+// commit adds a new commit to the remote repository `name` and returns its hash.
+func (e *testEnvironment) commit(name string) string {
+	e.t.Helper()
+	workDir := e.path("src", name)
+	e.git(workDir, "commit", "-q", "--allow-empty", "-m", "Change")
+	e.git(workDir, "push", "-q", "origin", "master")
+	return e.git(workDir, "rev-parse", "HEAD")
+}
+
+// commitModuleFile commits a new MODULE file with the content `moduleFile` to the remote repository `name`
+// and returns the hash of the commit.
+func (e *testEnvironment) commitModuleFile(name, moduleFile string) string {
+	e.t.Helper()
+	e.writeFile(e.path("src", name, "MODULE"), moduleFile)
+	e.git(e.path("src", name), "add", "-A")
+	return e.commit(name)
+}
+
+// createWorkspace creates the workspace `name` with a MODULE file that has the content `moduleFile`.
+func (e *testEnvironment) createWorkspace(name, moduleFile string) string {
+	e.t.Helper()
+	workspaceRoot := e.path(name)
+	e.writeFile(path.Join(workspaceRoot, "MODULE"), moduleFile)
+	e.git(workspaceRoot, "init", "-q", "-b", "master")
+	e.git(workspaceRoot, "remote", "add", "origin", e.url(name))
+	return workspaceRoot
+}
+
+// dbt runs a dbt command in `dir` and returns its output.
+func (e *testEnvironment) dbt(dir string, args ...string) (string, error) {
+	data, err := json.Marshal(args)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	cmd := exec.Command(os.Args[0])
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), testArgsVariable+"="+string(data), "DBT_CONFIG_DIR="+e.path("config"), "NO_COLOR=1")
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+// mustDbt runs a dbt command in `dir` and fails the test if the command fails.
+func (e *testEnvironment) mustDbt(dir string, args ...string) string {
+	e.t.Helper()
+	output, err := e.dbt(dir, args...)
+	if err != nil {
+		e.t.Fatalf("dbt %s failed: %s\n%s", strings.Join(args, " "), err, output)
+	}
+	return output
+}
+
+// head returns the commit the git repository at `dir` is checked out at.
+func (e *testEnvironment) head(dir string) string {
+	e.t.Helper()
+	return e.git(dir, "rev-parse", "HEAD")
+}
+
+// gitMirrorEntry returns the path of the entry for the git repository at `url` in the mirror `mirrorDir`.
+func gitMirrorEntry(mirrorDir, url string) string {
+	return path.Join(mirrorDir, fmt.Sprintf("git-%x", sha256.Sum256([]byte(url))))
+}
+
+func dependencyModuleFile(deps ...string) string {
+	moduleFile := "version: 3\ndependencies:\n"
+	for _, dep := range deps {
+		moduleFile += dep
+	}
+	return moduleFile
+}
+
+func dependency(name, url, hash string) string {
+	dep := fmt.Sprintf("  %s:\n    url: %s\n    version: origin/master\n", name, url)
+	if hash != "" {
+		dep += fmt.Sprintf("    hash: %s\n", hash)
+	}
+	return dep
+}
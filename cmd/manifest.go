@@ -55,7 +55,7 @@ func runManifestDiff(cmd *cobra.Command, args []string) {
 		workspaceRoot := util.GetWorkspaceRoot()
 		var err error
 
-		manifestNew, err = manifest.Generate(module.GetAllModules(workspaceRoot), true)
+		manifestNew, err = manifest.Generate(module.GetAllModules(workspaceRoot), module.GetOverrides(workspaceRoot), true)
 		if err != nil {
 			// This is never expected to fail when allowUncommittedChanges is true, but in case it does...
 			log.Fatal("manifest.Generate failed unexpectedly: %s\n", err.Error())
@@ -96,6 +96,9 @@ func runManifestDiff(cmd *cobra.Command, args []string) {
 			log.Log("%s:\n", addedMod.Name)
 			log.IndentationLevel = 2
 			log.Log("URL: %s\n", addedMod.Url)
+			if addedMod.Subdir != "" {
+				log.Log("Subdirectory: %s\n", addedMod.Subdir)
+			}
 			log.Log("Hash: %s\n", addedMod.Hash)
 			log.Log("Type: %s\n", addedMod.Type)
 			log.IndentationLevel = 0
@@ -110,6 +113,9 @@ func runManifestDiff(cmd *cobra.Command, args []string) {
 			log.Log("%s:\n", removedMod.Name)
 			log.IndentationLevel = 2
 			log.Log("URL: %s\n", removedMod.Url)
+			if removedMod.Subdir != "" {
+				log.Log("Subdirectory: %s\n", removedMod.Subdir)
+			}
 			log.Log("Hash: %s\n", removedMod.Hash)
 			log.Log("Type: %s\n", removedMod.Type)
 			log.IndentationLevel = 0
@@ -129,6 +135,9 @@ func runManifestDiff(cmd *cobra.Command, args []string) {
 			if modifiedMod.New.Url != modifiedMod.Old.Url {
 				log.Log("URL changed from %q to %q\n", modifiedMod.Old.Url, modifiedMod.New.Url)
 			}
+			if modifiedMod.New.Subdir != modifiedMod.Old.Subdir {
+				log.Log("Subdirectory changed from %q to %q\n", modifiedMod.Old.Subdir, modifiedMod.New.Subdir)
+			}
 			if modifiedMod.New.Hash != modifiedMod.Old.Hash {
 				log.Log("Hash changed from %q to %q\n", modifiedMod.Old.Hash, modifiedMod.New.Hash)
 				log.IndentationLevel = 3
@@ -157,6 +166,20 @@ func runManifestDiff(cmd *cobra.Command, args []string) {
 
 				log.IndentationLevel = 2
 			}
+			for _, submodule := range modifiedMod.AddedSubmodules {
+				log.Log("Submodule %q added at %q\n", submodule.Path, submodule.Hash)
+			}
+			for _, submodule := range modifiedMod.RemovedSubmodules {
+				log.Log("Submodule %q removed\n", submodule.Path)
+			}
+			for _, submodule := range modifiedMod.ModifiedSubmodules {
+				if submodule.New.Url != submodule.Old.Url {
+					log.Log("Submodule %q URL changed from %q to %q\n", submodule.New.Path, submodule.Old.Url, submodule.New.Url)
+				}
+				if submodule.New.Hash != submodule.Old.Hash {
+					log.Log("Submodule %q hash changed from %q to %q\n", submodule.New.Path, submodule.Old.Hash, submodule.New.Hash)
+				}
+			}
 			if modifiedMod.New.Type != modifiedMod.Old.Type {
 				log.Log("Type changed from %q to %q\n", modifiedMod.Old.Type, modifiedMod.New.Type)
 			}
@@ -178,7 +201,7 @@ func runManifestDiff(cmd *cobra.Command, args []string) {
 func runManifestGenerate(cmd *cobra.Command, args []string) {
 	workspaceRoot := util.GetWorkspaceRoot()
 
-	manifest, err := manifest.Generate(module.GetAllModules(workspaceRoot), manifestAllowUncommittedChanges)
+	manifest, err := manifest.Generate(module.GetAllModules(workspaceRoot), module.GetOverrides(workspaceRoot), manifestAllowUncommittedChanges)
 	if err != nil {
 		log.Fatal("%s\n", err)
 	}
@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/daedaleanai/dbt/v3/config"
+	"github.com/daedaleanai/dbt/v3/log"
+	"github.com/daedaleanai/dbt/v3/module"
+
+	"github.com/daedaleanai/cobra"
+)
+
+var mirrorCmd = &cobra.Command{
+	Use:   "mirror",
+	Args:  cobra.NoArgs,
+	Short: "Manages the local mirror",
+	Long:  `Manages the local mirror.`,
+}
+
+var mirrorGcUnusedFor int
+var mirrorGcUnreferenced bool
+var mirrorGcDryRun bool
+var mirrorGcForce bool
+
+func init() {
+	gcCommand := &cobra.Command{
+		Use:   "gc [--unused-for=DAYS] [--unreferenced] [--dry-run] [--force]",
+		Args:  cobra.NoArgs,
+		Short: "Lists the entries of the local mirror and removes unused entries",
+		Long: `Lists the entries of the local mirror with their size and the time of their last use.
+With --unused-for, entries that have not been used for the given number of days are removed.
+With --unreferenced, entries that are not referenced by any workspace on this machine are removed.
+Git entries that are referenced by a workspace that has been synced with the mirror are never removed,
+since its modules borrow objects from them. Workspaces that have not been synced since dbt started
+recording them are not known, so removing git entries requires --force.`,
+		Run: runMirrorGc,
+	}
+	gcCommand.Flags().IntVar(&mirrorGcUnusedFor, "unused-for", 0, "Remove entries that have not been used for DAYS days.")
+	gcCommand.Flags().BoolVar(&mirrorGcUnreferenced, "unreferenced", false, "Remove entries that are not referenced by any workspace that has been synced with this mirror.")
+	gcCommand.Flags().BoolVar(&mirrorGcDryRun, "dry-run", false, "Print which entries would be removed without removing them.")
+	gcCommand.Flags().BoolVar(&mirrorGcForce, "force", false, "Remove git entries, although they might be used by workspaces that have not been synced with the mirror since dbt started recording them.")
+	mirrorCmd.AddCommand(gcCommand)
+
+	rootCmd.AddCommand(mirrorCmd)
+}
+
+func runMirrorGc(cmd *cobra.Command, args []string) {
+	if config.GetConfig().Mirror == "" {
+		log.Fatal("No mirror is configured.\n")
+	}
+	if mirrorGcUnusedFor < 0 {
+		log.Fatal("--unused-for must not be negative.\n")
+	}
+
+	entries, err := module.ListMirrorEntries()
+	if err != nil {
+		log.Fatal("Failed to list the entries of the mirror: %s.\n", err)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.Before(entries[j].LastUsed)
+	})
+
+	// The references of all registered workspaces are needed to protect their git entries.
+	referenced := map[string]bool{}
+	if mirrorGcUnusedFor > 0 || mirrorGcUnreferenced {
+		workspaces, err := module.MirrorWorkspaces()
+		if err != nil {
+			log.Fatal("Failed to read the workspaces that use the mirror: %s.\n", err)
+		}
+		for _, workspace := range workspaces {
+			log.Debug("Workspace '%s' uses the mirror.\n", workspace)
+			workspaceEntries, err := module.ReferencedMirrorEntries(workspace)
+			if err != nil {
+				log.Warning("Failed to find all mirror entries referenced by workspace '%s': %s.\n", workspace, err)
+			}
+			for entryPath := range workspaceEntries {
+				referenced[entryPath] = true
+			}
+		}
+	}
+
+	now := time.Now()
+	reasons := map[string]string{}
+	gitRemovals := 0
+	for _, entry := range entries {
+		reason := ""
+		if entry.IsGit() && referenced[entry.Path] {
+			log.Debug("Keeping '%s', which is referenced by a workspace.\n", entry.Path)
+		} else if mirrorGcUnusedFor > 0 && now.Sub(entry.LastUsed) > time.Duration(mirrorGcUnusedFor)*24*time.Hour {
+			reason = fmt.Sprintf("unused for more than %d days", mirrorGcUnusedFor)
+		} else if mirrorGcUnreferenced && !referenced[entry.Path] {
+			reason = "not referenced by any workspace"
+		}
+		if reason != "" {
+			reasons[entry.Path] = reason
+			if entry.IsGit() {
+				gitRemovals++
+			}
+		}
+	}
+	if gitRemovals > 0 {
+		message := fmt.Sprintf("Removing %d git entries breaks the modules of workspaces that use them, but have not been synced "+
+			"with the mirror since dbt started recording them.", gitRemovals)
+		switch {
+		case !mirrorGcForce && mirrorGcDryRun:
+			log.Warning("%s The entries are only removed with --force.\n", message)
+		case !mirrorGcForce:
+			log.Fatal("%s Run 'dbt sync' in all workspaces that use the mirror and rerun with --force.\n", message)
+		case !mirrorGcDryRun:
+			log.Warning("%s\n", message)
+		}
+	}
+
+	removedCount := 0
+	removedSize := int64(0)
+	totalSize := int64(0)
+	for _, entry := range entries {
+		totalSize += entry.Size
+		reason := reasons[entry.Path]
+
+		url := entry.URL
+		if url == "" {
+			url = "<unknown url>"
+		}
+		line := fmt.Sprintf("%-9s %10s  %s", formatAge(now.Sub(entry.LastUsed)), formatSize(entry.Size), url)
+		if reason == "" {
+			log.Log("%s\n", line)
+			continue
+		}
+
+		if !mirrorGcDryRun {
+			if err := entry.Remove(); err != nil {
+				log.Error("%s: failed to remove '%s': %s.\n", line, entry.Path, err)
+				continue
+			}
+		}
+		removedCount++
+		removedSize += entry.Size
+		if mirrorGcDryRun {
+			log.Warning("%s: would be removed (%s)\n", line, reason)
+		} else {
+			log.Warning("%s: removed (%s)\n", line, reason)
+		}
+	}
+
+	log.Log("\n")
+	if mirrorGcDryRun {
+		log.Success("Would remove %d of %d entries and free %s of %s.\n", removedCount, len(entries), formatSize(removedSize), formatSize(totalSize))
+	} else {
+		log.Success("Removed %d of %d entries and freed %s of %s.\n", removedCount, len(entries), formatSize(removedSize), formatSize(totalSize))
+	}
+}
+
+// formatAge formats a duration in days, hours or minutes.
+func formatAge(age time.Duration) string {
+	switch {
+	case age >= 24*time.Hour:
+		return fmt.Sprintf("%dd ago", int(age.Hours()/24))
+	case age >= time.Hour:
+		return fmt.Sprintf("%dh ago", int(age.Hours()))
+	default:
+		return fmt.Sprintf("%dm ago", int(age.Minutes()))
+	}
+}
+
+// formatSize formats a size in bytes using binary prefixes.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value := float64(size) / unit
+	prefixes := "KMGTPE"
+	i := 0
+	for value >= unit && i < len(prefixes)-1 {
+		value /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, prefixes[i])
+}
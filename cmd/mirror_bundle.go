@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"github.com/daedaleanai/dbt/v3/log"
+	"github.com/daedaleanai/dbt/v3/manifest"
+	"github.com/daedaleanai/dbt/v3/module"
+	"github.com/daedaleanai/dbt/v3/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+var mirrorExportManifest string
+var mirrorExportOutput string
+
+func init() {
+	exportCommand := &cobra.Command{
+		Use:   "export --manifest=MANIFEST [-o BUNDLE]",
+		Args:  cobra.NoArgs,
+		Short: "Exports the mirror entries of all modules of a manifest to a single bundle file",
+		Long: `Exports the mirror entries of all modules and submodules of a manifest generated by
+'dbt manifest generate' to a single bundle file, which can be imported with 'dbt mirror import'
+on a machine without network access.`,
+		Run: runMirrorExport,
+	}
+	exportCommand.Flags().StringVar(&mirrorExportManifest, "manifest", "", "Manifest that lists the modules to export.")
+	exportCommand.Flags().StringVarP(&mirrorExportOutput, "output", "o", "deps.bundle", "File where the bundle will be stored.")
+	mirrorCmd.AddCommand(exportCommand)
+
+	importCommand := &cobra.Command{
+		Use:   "import BUNDLE",
+		Args:  cobra.ExactArgs(1),
+		Short: "Imports a bundle created by 'dbt mirror export' into the local mirror",
+		Long:  `Imports a bundle created by 'dbt mirror export' into the local mirror.`,
+		Run:   runMirrorImport,
+	}
+	mirrorCmd.AddCommand(importCommand)
+}
+
+func runMirrorExport(cmd *cobra.Command, args []string) {
+	if mirrorExportManifest == "" {
+		log.Fatal("--manifest is required.\n")
+	}
+
+	var m manifest.Manifest
+	util.ReadYaml(mirrorExportManifest, &m)
+	modules := []module.MirrorBundleModule{}
+	for _, mod := range m.Modules {
+		if mod.Overridden {
+			log.Warning("Skipping module '%s', which is overridden by a local directory.\n", mod.Name)
+			continue
+		}
+		modules = append(modules, module.MirrorBundleModule{Name: mod.Name, URL: mod.Url, Type: mod.Type, Hash: mod.Hash})
+		for _, submodule := range mod.Submodules {
+			modules = append(modules, module.MirrorBundleModule{
+				Name: mod.Name + "/" + submodule.Path,
+				URL:  submodule.Url,
+				Type: module.GitModuleType.String(),
+				Hash: submodule.Hash,
+			})
+		}
+	}
+
+	exported, err := module.ExportMirrorBundle(mirrorExportOutput, modules)
+	if err != nil {
+		log.Fatal("Failed to export mirror bundle: %s.\n", err)
+	}
+	log.Success("Exported %d module(s) to '%s'.\n", exported, mirrorExportOutput)
+}
+
+func runMirrorImport(cmd *cobra.Command, args []string) {
+	urls, err := module.ImportMirrorBundle(args[0])
+	if err != nil {
+		log.Fatal("Failed to import mirror bundle: %s.\n", err)
+	}
+	log.Success("Imported %d module(s) from '%s'.\n", len(urls), args[0])
+}
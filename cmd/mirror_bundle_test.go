@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/daedaleanai/dbt/v3/manifest"
+	"github.com/daedaleanai/dbt/v3/module"
+	"github.com/daedaleanai/dbt/v3/util"
+)
+
+// createArchive creates the archive `name`.tar.gz, which contains a MODULE file in the directory `name`,
+// and returns its url.
+func (e *testEnvironment) createArchive(name string) string {
+	e.t.Helper()
+	archivePath := e.path("archives", name+".tar.gz")
+	if err := os.MkdirAll(path.Dir(archivePath), 0755); err != nil {
+		e.t.Fatal(err)
+	}
+	file, err := os.Create(archivePath)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	defer file.Close()
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+	content := []byte("version: 3\n")
+	if err := tarWriter.WriteHeader(&tar.Header{Name: name + "/", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		e.t.Fatal(err)
+	}
+	if err := tarWriter.WriteHeader(&tar.Header{Name: name + "/MODULE", Mode: 0644, Size: int64(len(content))}); err != nil {
+		e.t.Fatal(err)
+	}
+	if _, err := tarWriter.Write(content); err != nil {
+		e.t.Fatal(err)
+	}
+	if err := tarWriter.Close(); err != nil {
+		e.t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		e.t.Fatal(err)
+	}
+	return "file://" + archivePath
+}
+
+func TestMirrorExportImportAllowsOfflineSync(t *testing.T) {
+	e := newTestEnvironment(t)
+	hash := e.createRepo("a", "version: 3\n")
+	archiveURL := e.createArchive("lib")
+	moduleFile := dependencyModuleFile(dependency("a", e.url("a"), hash), dependency("lib", archiveURL, ""))
+	workspaceRoot := e.createWorkspace("ws", moduleFile)
+	e.mustDbt(workspaceRoot, "sync")
+
+	// 'dbt manifest generate' requires a release build, so the manifest is written directly.
+	archiveHash := sha256.Sum256([]byte(e.readFile(e.path("archives", "lib.tar.gz"))))
+	util.WriteYaml(e.path("manifest.yaml"), manifest.Manifest{Modules: []manifest.Module{
+		{Name: "a", Url: e.url("a"), Hash: hash, Type: module.GitModuleType.String()},
+		{Name: "lib", Url: archiveURL, Hash: fmt.Sprintf("%x", archiveHash), Type: module.TarGzModuleType.String()},
+	}})
+	e.mustDbt(workspaceRoot, "mirror", "export", "--manifest="+e.path("manifest.yaml"), "-o", e.path("deps.bundle"))
+
+	// Import the bundle into an empty mirror on a machine without access to the remotes.
+	for _, dir := range []string{"remotes", "archives"} {
+		if err := os.RemoveAll(e.path(dir)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e.writeConfig("mirror: %s\noffline: true\nretries: 0\n", e.path("offline-mirror"))
+	offlineWorkspaceRoot := e.createWorkspace("offline-ws", e.readFile(path.Join(workspaceRoot, util.ModuleFileName)))
+	e.mustDbt(offlineWorkspaceRoot, "mirror", "import", e.path("deps.bundle"))
+
+	e.mustDbt(offlineWorkspaceRoot, "sync")
+	depsDir := path.Join(offlineWorkspaceRoot, util.DepsDirName)
+	if head := e.head(path.Join(depsDir, "a")); head != hash {
+		t.Errorf("expected 'a' to be checked out at '%s', got '%s'", hash, head)
+	}
+	if !util.FileExists(path.Join(depsDir, "lib", util.ModuleFileName)) {
+		t.Errorf("expected 'lib' to be extracted")
+	}
+}
@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/daedaleanai/dbt/v3/config"
+	"github.com/daedaleanai/dbt/v3/log"
+	"github.com/daedaleanai/dbt/v3/manifest"
+	"github.com/daedaleanai/dbt/v3/module"
+	"github.com/daedaleanai/dbt/v3/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+func init() {
+	prefetchCommand := &cobra.Command{
+		Use:   "prefetch [MANIFEST]",
+		Args:  cobra.MaximumNArgs(1),
+		Short: "Populates the local mirror with all modules required by the workspace or a manifest",
+		Long: `Populates the local mirror with all modules required by the workspace or a manifest.
+Without arguments, the MODULE files of the workspace and all of its dependencies are read from the
+mirror and every mirror entry they reference is created or updated. With MANIFEST, a manifest
+generated by 'dbt manifest generate', the modules and submodules listed in the manifest are mirrored.
+Afterwards, every pinned hash must be present in the mirror.`,
+		Run: runMirrorPrefetch,
+	}
+	mirrorCmd.AddCommand(prefetchCommand)
+}
+
+// mirrorPrefetcher creates and updates mirror entries and checks that they contain the pinned hashes.
+type mirrorPrefetcher struct {
+	// Mirrors that have already been updated, by their paths.
+	updated map[string]bool
+	// Url, subdirectory and hash of every module that has already been prefetched.
+	prefetched map[string]bool
+	// Local directories of overridden dependencies that have already been visited.
+	overrides map[string]bool
+	count     int
+	failures  []string
+}
+
+func runMirrorPrefetch(cmd *cobra.Command, args []string) {
+	if config.GetConfig().Mirror == "" {
+		log.Fatal("No mirror is configured.\n")
+	}
+	if config.GetConfig().Offline {
+		log.Fatal("Mirrors cannot be prefetched in offline mode.\n")
+	}
+	log.OnFatal(printRetriedOperations)
+
+	prefetcher := mirrorPrefetcher{updated: map[string]bool{}, prefetched: map[string]bool{}, overrides: map[string]bool{}}
+	if len(args) == 1 {
+		var m manifest.Manifest
+		util.ReadYaml(args[0], &m)
+		prefetcher.prefetchManifest(m)
+	} else {
+		workspaceRoot := util.GetWorkspaceRoot()
+		log.Debug("Workspace: %s.\n", workspaceRoot)
+		module.RegisterMirrorWorkspace(workspaceRoot)
+		prefetcher.prefetchWorkspace(workspaceRoot)
+	}
+
+	printRetriedOperations()
+	if len(prefetcher.failures) > 0 {
+		log.IndentationLevel = 0
+		for _, failure := range prefetcher.failures {
+			log.Error("%s", failure)
+		}
+		log.Fatal("Failed to prefetch %d module(s).\n", len(prefetcher.failures))
+	}
+	log.Success("Prefetched %d module version(s).\n", prefetcher.count)
+}
+
+// prefetchWorkspace prefetches all dependencies of the workspace at `workspaceRoot`. The MODULE files of
+// the dependencies are read from the mirror at every hash they are pinned to, so all hashes that might be
+// needed by 'dbt sync' are prefetched.
+func (p *mirrorPrefetcher) prefetchWorkspace(workspaceRoot string) {
+	workspaceModuleFile := module.ReadModuleFile(workspaceRoot)
+	overrides := module.GetOverrides(workspaceRoot)
+
+	queue := []module.ModuleFile{workspaceModuleFile}
+	isWorkspace := true
+	for len(queue) > 0 {
+		moduleFile := queue[0]
+		queue = queue[1:]
+
+		for _, name := range dependencyNames(moduleFile) {
+			dep := moduleFile.Dependencies[name]
+			if localPath, overridden := overrides[name]; overridden {
+				log.Debug("Dependency '%s' is overridden by '%s'.\n", name, localPath)
+				if !p.overrides[localPath] {
+					p.overrides[localPath] = true
+					queue = append(queue, module.ReadModuleFile(localPath))
+				}
+				continue
+			}
+
+			hashes := []string{dep.Hash}
+			if resolved, ok := workspaceModuleFile.Resolution[name]; ok && resolved != dep.Hash {
+				hashes = append(hashes, resolved)
+			}
+			for _, hash := range hashes {
+				if hash == "" && !isWorkspace {
+					p.fail("Dependency '%s' does not pin a hash.\n", name)
+					continue
+				}
+				moduleFile, ok := p.prefetch(name, dep.ResolvedURL(), dep.Type, dep.Subdir, hash, dep.Version)
+				if ok {
+					queue = append(queue, moduleFile)
+				}
+			}
+		}
+		isWorkspace = false
+	}
+}
+
+// prefetchManifest prefetches all modules and submodules listed in the manifest `m`.
+func (p *mirrorPrefetcher) prefetchManifest(m manifest.Manifest) {
+	for _, mod := range m.Modules {
+		if mod.Overridden {
+			log.Warning("Skipping module '%s', which is overridden by a local directory.\n", mod.Name)
+			continue
+		}
+		p.prefetch(mod.Name, mod.Url, mod.Type, mod.Subdir, mod.Hash, "")
+		for _, submodule := range mod.Submodules {
+			p.prefetch(fmt.Sprintf("%s/%s", mod.Name, submodule.Path), submodule.Url, module.GitModuleType.String(), "", submodule.Hash, "")
+		}
+	}
+}
+
+// prefetch creates or updates the mirror entry of the module `name` and checks that it contains `hash`.
+// If `hash` is empty, `version` is resolved in the mirror instead. For git modules, the submodules at
+// `hash` are prefetched as well. Returns the MODULE file of the module at `hash`.
+func (p *mirrorPrefetcher) prefetch(name, url, moduleType, subdir, hash, version string) (module.ModuleFile, bool) {
+	if module.DetermineModuleType(url, moduleType) == module.LocalModuleType {
+		log.Debug("Module '%s' is a local module, which is not mirrored.\n", name)
+		return module.ModuleFile{}, false
+	}
+
+	mirror, err := module.GetMirror(url, moduleType, subdir)
+	if err != nil {
+		p.fail("Module '%s': %s.\n", name, err)
+		return module.ModuleFile{}, false
+	}
+	if !p.updated[mirror.Path()] {
+		p.updated[mirror.Path()] = true
+		log.Log("Updating mirror of '%s' (%s).\n", name, url)
+		if err := mirror.Update(); err != nil {
+			p.fail("Module '%s': %s.\n", name, err)
+			return module.ModuleFile{}, false
+		}
+	}
+
+	if hash == "" && version == "" {
+		p.fail("Module '%s' has no hash.\n", name)
+		return module.ModuleFile{}, false
+	}
+	if hash == "" {
+		hash, err = mirror.RevParse(version)
+		if err != nil {
+			p.fail("Module '%s': %s.\n", name, err)
+			return module.ModuleFile{}, false
+		}
+	}
+	key := fmt.Sprintf("%s:%s@%s", url, subdir, hash)
+	if p.prefetched[key] {
+		return module.ModuleFile{}, false
+	}
+	p.prefetched[key] = true
+
+	if !mirror.HasRevision(hash) {
+		p.fail("Module '%s': the mirror of '%s' does not contain hash '%s'.\n", name, url, hash)
+		return module.ModuleFile{}, false
+	}
+	log.Debug("Mirror of '%s' contains hash '%s'.\n", name, hash)
+	p.count++
+
+	if gitMirror, isGit := mirror.(*module.GitMirror); isGit {
+		submodules, err := gitMirror.Submodules(hash)
+		if err != nil {
+			p.fail("Module '%s': %s.\n", name, err)
+		}
+		for _, submodule := range submodules {
+			p.prefetch(fmt.Sprintf("%s/%s", name, submodule.Path), submodule.URL, module.GitModuleType.String(), "", submodule.Hash, "")
+		}
+	}
+
+	moduleFile, err := mirror.ReadModuleFile(hash)
+	if err != nil {
+		p.fail("Module '%s': %s.\n", name, err)
+		return module.ModuleFile{}, false
+	}
+	return moduleFile, true
+}
+
+func (p *mirrorPrefetcher) fail(format string, a ...interface{}) {
+	p.failures = append(p.failures, fmt.Sprintf(format, a...))
+}
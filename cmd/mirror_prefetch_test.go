@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/daedaleanai/dbt/v3/util"
+)
+
+func TestMirrorPrefetchFillsEmptyMirror(t *testing.T) {
+	e := newTestEnvironment(t)
+	hashC := e.createRepo("c", "version: 3\n")
+	hashB := e.createRepo("b", dependencyModuleFile(dependency("c", e.url("c"), hashC)))
+	hashA := e.createRepo("a", "version: 3\n")
+	// The pinned hash of 'a' is not the tip of any branch anymore.
+	e.commit("a")
+	workspaceRoot := e.createWorkspace("ws", dependencyModuleFile(
+		dependency("a", e.url("a"), hashA),
+		dependency("b", e.url("b"), hashB)))
+
+	e.mustDbt(workspaceRoot, "mirror", "prefetch")
+
+	for name, hash := range map[string]string{"a": hashA, "b": hashB, "c": hashC} {
+		mirrorPath := gitMirrorEntry(e.path("mirror"), e.url(name))
+		if !util.DirExists(mirrorPath) {
+			t.Fatalf("expected the mirror to contain '%s'", name)
+		}
+		e.git(mirrorPath, "cat-file", "-e", hash+"^{commit}")
+	}
+
+	// The workspace can be synced from the mirror alone.
+	if err := os.RemoveAll(e.path("remotes")); err != nil {
+		t.Fatal(err)
+	}
+	e.mustDbt(workspaceRoot, "sync", "--offline")
+	if head := e.head(path.Join(workspaceRoot, util.DepsDirName, "c")); head != hashC {
+		t.Errorf("expected 'c' to be checked out at '%s', got '%s'", hashC, head)
+	}
+}
@@ -2,7 +2,9 @@ package cmd
 
 import (
 	"os"
+	"time"
 
+	"github.com/daedaleanai/dbt/v3/config"
 	"github.com/daedaleanai/dbt/v3/log"
 	"github.com/daedaleanai/dbt/v3/util"
 
@@ -16,17 +18,39 @@ var (
 		Long: `The Daedalean Build Tool (dbt) helps setting up workspaces consisting
 of multiple modules (git repositories), managing dependencies between modules, and
 building build targets defined in those modules.`,
-		Version: util.Version(),
 	}
 )
 
+var offline bool
+var retries int
+var retryDelay, networkTimeout time.Duration
+
 func init() {
-	cobra.OnInitialize(initWorkspace)
+	cobra.OnInitialize(initConfig, initWorkspace)
 
 	rootCmd.PersistentFlags().BoolVarP(&log.Verbose, "verbose", "v", false, "print debug output")
 	rootCmd.PersistentFlags().BoolVar(&log.NoColor, "no-color", false, "does not colorize the output")
 	rootCmd.PersistentFlags().BoolVar(&util.FlagNoWorkspaceChecks, "no-workspace-checks", false,
 		"DANGEROUS: skip checks that the special purpose directories (BUILD, DEPS) are not adjusted by the user")
+	rootCmd.PersistentFlags().BoolVar(&offline, "offline", false, "never access the network, only use local modules and the mirror")
+	rootCmd.PersistentFlags().IntVar(&retries, "retries", 3, "retry failed network operations up to N times")
+	rootCmd.PersistentFlags().DurationVar(&retryDelay, "retry-delay", time.Second, "delay before the first retry of a failed network operation (doubles with every retry)")
+	rootCmd.PersistentFlags().DurationVar(&networkTimeout, "network-timeout", 0, "time limit for each network operation including its retries (0 means no limit)")
+}
+
+func initConfig() {
+	if offline {
+		config.Override(func(c *config.Config) { c.Offline = true })
+	}
+	if rootCmd.PersistentFlags().Changed("retries") {
+		config.Override(func(c *config.Config) { c.Retries = &retries })
+	}
+	if rootCmd.PersistentFlags().Changed("retry-delay") {
+		config.Override(func(c *config.Config) { c.RetryDelay = &retryDelay })
+	}
+	if rootCmd.PersistentFlags().Changed("network-timeout") {
+		config.Override(func(c *config.Config) { c.NetworkTimeout = networkTimeout })
+	}
 }
 
 func initWorkspace() {
@@ -36,6 +60,8 @@ func initWorkspace() {
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
+	// The version is only determined when running dbt, so that the package can be tested without build tags.
+	rootCmd.Version = util.Version()
 	if rootCmd.Execute() != nil {
 		os.Exit(1)
 	}
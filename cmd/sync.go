@@ -1,12 +1,19 @@
 package cmd
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io/fs"
 	"os"
+	"os/signal"
 	"path"
+	"runtime"
 	"strings"
+	"sync"
+	"syscall"
 
+	"github.com/daedaleanai/dbt/v3/config"
 	"github.com/daedaleanai/dbt/v3/log"
 	"github.com/daedaleanai/dbt/v3/module"
 	"github.com/daedaleanai/dbt/v3/util"
@@ -26,12 +33,18 @@ declared in the MODULE files of each module, starting from the top-level MODULE
 var update bool
 var ignoreErrors bool
 var strict bool
+var syncJobs int
+var syncDryRun bool
+var syncJson bool
 
 func init() {
 	// Whether to use 'master' instead of the version specified in the MODULE file.
 	syncCmd.Flags().BoolVar(&update, "update", false, "Recompute all dependency hashes based on the version string.")
 	syncCmd.Flags().BoolVar(&ignoreErrors, "ignore-errors", false, "Ignore all errors while pinning and checking dependencies.")
 	syncCmd.Flags().BoolVar(&strict, "strict", false, "Check that all dependency hashes are present and the chosen commit is an ancestor of the commit described by version string.")
+	syncCmd.Flags().IntVarP(&syncJobs, "jobs", "j", runtime.NumCPU(), "Clone and fetch up to N modules in parallel.")
+	syncCmd.Flags().BoolVar(&syncDryRun, "dry-run", false, "Print which modules would be cloned, checked out and deleted without changing the workspace.")
+	syncCmd.Flags().BoolVar(&syncJson, "json", false, "Print the --dry-run plan as JSON.")
 	rootCmd.AddCommand(syncCmd)
 }
 
@@ -39,17 +52,41 @@ func runSync(cmd *cobra.Command, args []string) {
 	if update && strict {
 		log.Fatal("--update and --strict can not be used together.\n")
 	}
+	if syncJobs < 1 {
+		log.Fatal("--jobs must be at least 1.\n")
+	}
 
 	workspaceRoot := util.GetWorkspaceRoot()
 	log.Debug("Workspace: %s.\n", workspaceRoot)
 
+	// Prevent other dbt processes from using the workspace while it is being synced. The dry run
+	// holds the lock as well, so that it does not read the workspace while another sync changes it.
+	lock := util.LockWorkspace(workspaceRoot)
+	defer lock.Unlock()
+
+	syncWorkspace(workspaceRoot)
+}
+
+// syncWorkspace syncs the workspace at `workspaceRoot`. The caller must hold the lock of the workspace.
+func syncWorkspace(workspaceRoot string) {
 	workspaceModuleFile := module.ReadModuleFile(workspaceRoot)
 	workspaceModuleName := module.OpenModule(workspaceRoot).Name()
 	log.Debug("Workspace module name: '%s'\n", workspaceModuleName)
 
+	if syncDryRun {
+		runSyncDryRun(workspaceRoot, workspaceModuleName)
+		return
+	}
+	if syncJson {
+		log.Fatal("--json can only be used together with --dry-run.\n")
+	}
+
 	// Ensure DEPS/ directory exists, and warn if it seems to be mangled by the user.
 	util.EnsureManagedDir(util.DepsDirName)
 
+	// Remember the workspace, so that 'dbt mirror gc' keeps the mirror entries it uses.
+	module.RegisterMirrorWorkspace(workspaceRoot)
+
 	workspaceModuleSymlink := ""
 	if workspaceModuleFile.Layout != "cpp" {
 		// Create the DEPS/ subdirectory and create a symlink to the top-level module.
@@ -64,6 +101,18 @@ func runSync(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	// Report retried network operations also if the sync fails (after the rollback).
+	unregisterRetrySummary := log.OnFatal(printRetriedOperations)
+	defer unregisterRetrySummary()
+
+	// Roll back all changes to the workspace if the sync fails.
+	tx := beginSyncTransaction(workspaceRoot)
+
+	// Interrupts stop the sync at the next module, which then fails and is rolled back like any other
+	// failed sync. Running git commands are interrupted as well if they are in the same process group.
+	ctx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
 	errorFunc := func(format string, a ...interface{}) {
 		log.Error(format, a...)
 		log.Fatal("Use --ignore-errors to ignore this error.\n")
@@ -72,145 +121,424 @@ func runSync(cmd *cobra.Command, args []string) {
 		errorFunc = log.Warning
 	}
 
-	// Modules that have been processed.
-	done := map[string]bool{}
+	s := syncer{
+		workspaceRoot:       workspaceRoot,
+		workspaceModuleName: workspaceModuleName,
+		errorFunc:           errorFunc,
+		overrides:           module.GetOverrides(workspaceRoot),
+		modules:             map[string]module.Module{},
+		created:             map[string]bool{},
+	}
+	upgrades := map[string]hashPin{}
+	for !s.resolve(ctx, workspaceModuleFile.Resolution, upgrades) {
+		log.IndentationLevel = 0
+		log.Log("Restarting the dependency resolution with the upgraded hashes.\n\n")
+	}
 
-	// Modules that have been fetched.
-	fetched := map[string]bool{}
+	if len(s.missing) > 0 {
+		log.IndentationLevel = 0
+		log.Error("The following modules are not available offline:\n")
+		log.IndentationLevel = 1
+		for _, missing := range util.OrderedValues(s.missing) {
+			log.Log("%s\n", missing)
+		}
+		log.IndentationLevel = 0
+		log.Fatal("Sync the workspace without --offline first.\n")
+	}
 
-	// Modules that still need to be processed.
-	queue := []string{workspaceRoot}
+	log.IndentationLevel = 0
+	checkInterrupted(ctx)
 
-	// Pinned dependency URLs / hashes.
-	pinnedUrls := map[string]string{}
-	pinnedHashes := map[string]string{}
+	// Delete everything in the DEPS folder that does not belong there
+	depsDir := path.Join(workspaceRoot, util.DepsDirName)
+	content, err := os.ReadDir(depsDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Fatal("%v", err)
+	}
 
-	for len(queue) > 0 {
-		modulePath := queue[0]
-		queue = queue[1:]
-		if done[modulePath] {
-			continue
+	if content != nil {
+		for _, info := range content {
+			fullPath := path.Join(depsDir, info.Name())
+			if info.Name() == module.SubdirReposDirName {
+				continue
+			}
+			if !s.done[fullPath] && fullPath != workspaceModuleSymlink && info.Name() != util.WarningFileName && info.Name() != util.LockFileName {
+				log.Log("Deleting '%s'\n", fullPath)
+				os.RemoveAll(fullPath)
+			}
 		}
-		done[modulePath] = true
+	}
 
-		moduleName := path.Base(modulePath)
-		log.IndentationLevel = 0
-		log.Log("Processing %s\n", moduleName)
-		log.IndentationLevel = 1
+	// Delete the repositories of subdirectory modules that are not used anymore.
+	reposDir := path.Join(depsDir, module.SubdirReposDirName)
+	repos, _ := os.ReadDir(reposDir)
+	for _, info := range repos {
+		if !module.IsSubdirLink(path.Join(depsDir, info.Name())) {
+			log.Log("Deleting '%s'\n", path.Join(reposDir, info.Name()))
+			os.RemoveAll(path.Join(reposDir, info.Name()))
+		}
+	}
+	if len(repos) > 0 {
+		// Only remove the directory if it is empty.
+		os.Remove(reposDir)
+	}
 
-		moduleFile := module.ReadModuleFile(modulePath)
+	if !strict {
+		// Updated the MODULE file.
+		for name, dep := range workspaceModuleFile.Dependencies {
+			if _, overridden := s.overrides[name]; overridden {
+				// Overridden dependencies keep their previously pinned hash.
+				continue
+			}
+			dep.Hash = s.resolver.pins.hash(name)
+			workspaceModuleFile.Dependencies[name] = dep
+		}
+		module.WriteModuleFile(workspaceRoot, workspaceModuleFile)
+	}
 
-		if len(moduleFile.Dependencies) == 0 {
-			log.IndentationLevel = 1
-			log.Log("Has no dependencies\n\n")
-			continue
+	tx.commit()
+	printRetriedOperations()
+	log.Success("Done.\n")
+}
+
+// checkInterrupted terminates the sync if it has been interrupted.
+func checkInterrupted(ctx context.Context) {
+	if ctx.Err() != nil {
+		log.IndentationLevel = 0
+		log.Fatal("Sync interrupted.\n")
+	}
+}
+
+// printRetriedOperations lists all network operations that had to be retried.
+func printRetriedOperations() {
+	retried := module.RetriedOperations()
+	if len(retried) == 0 {
+		return
+	}
+	log.IndentationLevel = 0
+	log.Warning("Retried %d network operation(s):\n", len(retried))
+	log.IndentationLevel = 1
+	for _, operation := range retried {
+		if operation.Err == nil {
+			log.Log("%s: succeeded after %d attempts.\n", operation.Description, operation.Attempts)
+		} else {
+			log.Log("%s: failed after %d attempts.\n", operation.Description, operation.Attempts)
 		}
+	}
+	log.IndentationLevel = 0
+}
 
-		for _, name := range dependencyNames(moduleFile) {
-			log.IndentationLevel = 1
-			log.Log("Depends on %s\n", name)
-			log.IndentationLevel = 2
+// syncer holds the state of a single 'dbt sync' run.
+type syncer struct {
+	workspaceRoot       string
+	workspaceModuleName string
+	errorFunc           func(format string, a ...interface{})
 
-			dep := moduleFile.Dependencies[name]
-			depModulePath := path.Join(workspaceRoot, util.DepsDirName, name)
-			queue = append(queue, depModulePath)
+	// Local directories that replace dependencies, by dependency name.
+	overrides map[string]string
 
-			// Check that the dependency URL matches the pinned URL for that module.
-			if _, isUrlPinned := pinnedUrls[name]; !isUrlPinned {
-				pinnedUrls[name] = dep.URL
-				log.Debug("Pinning URL to '%s'.\n", dep.URL)
-			}
-			if dep.URL != pinnedUrls[name] {
-				errorFunc("Dependency requires URL '%s', but URL has been pinned to '%s'.\n", dep.URL, pinnedUrls[name])
-			}
+	// Modules that have been opened or created and fetched, by module path.
+	modules map[string]module.Module
 
-			// Check that the on-disk module has the same URL.
-			depModule := module.OpenOrCreateModule(depModulePath, dep.URL, dep.Type, dep.Hash)
-			if depModule.URL() != dep.URL {
-				errorFunc("Dependency requires URL '%s', but the on-disk module has URL '%s'.\n", dep.URL, depModule.URL())
-			}
+	// Modules that have been created during this run and have not been set up yet.
+	created map[string]bool
 
-			// Make sure we have the latest changes and the working tree is clean.
-			if _, hasBeenFetched := fetched[depModulePath]; !hasBeenFetched {
-				depModule.Fetch()
-				fetched[depModulePath] = true
-			}
-			if depModule.IsDirty() {
-				errorFunc("The exiting module has local changes.\n")
-			}
+	// Modules whose MODULE files have been processed in the current traversal.
+	done map[string]bool
 
-			// Determine the commit hash for this dependency.
+	// Pins the URLs and hashes of all dependencies in the current traversal.
+	resolver *dependencyResolver
 
-			// In --strict mode all hashes must be set in the MODULE file.
-			if strict && dep.Hash == "" {
-				errorFunc("Hash must not be empty in --strict mode.\n")
-			}
+	// Modules or hashes that are not available in offline mode, by module name.
+	missing map[string]string
+}
 
-			// Resolve the version string to a hash if we are currently processsing the
-			// workspace module (only one module is "done") and the hash is not set yet or
-			// --update is used to force re-resolution of the version string to a hash.
-			if (update || dep.Hash == "") && len(done) == 1 {
-				dep.Hash = depModule.RevParse(dep.Version)
-				log.Debug("Resolved dependency version '%s' to hash '%s'.\n", dep.Version, dep.Hash[:7])
-			}
+// syncNode is a module whose dependencies are processed as part of a wave.
+type syncNode struct {
+	path       string
+	name       string
+	moduleFile module.ModuleFile
+	depNames   []string
+}
 
-			log.Log("Using hash '%s' for version '%s'.\n", dep.Hash[:7], dep.Version)
+// syncFetchJob describes a dependency that is opened or cloned and then fetched by a worker.
+// Workers run concurrently, so they must not call log.Fatal and only log to the logger of the job.
+type syncFetchJob struct {
+	path string
+	dep  module.Dependency
+
+	module  module.Module
+	created bool
+	err     error
+	// Logger of the job and its module, which collects all messages until all workers have finished.
+	logger *log.Logger
+}
 
-			// Check that the dependency hash is part of the tree that is referenced by the version string.
-			if !depModule.IsAncestor(dep.Hash, dep.Version) {
-				errorFunc(
-					"The dependency hash ('%s') is not an ancestor of the commit ('%s') the version string ('%s') currently resolves to.\n",
-					dep.Hash[:7], depModule.RevParse(dep.Version)[:7], dep.Version)
+func (s *syncer) depModulePath(name string) string {
+	return path.Join(s.workspaceRoot, util.DepsDirName, name)
+}
+
+// resolve traverses the dependency graph once, pinning and checking out all dependencies. It reports
+// false if the hash of a dependency had to be upgraded after the dependency's own MODULE file had already
+// been processed. In that case, the traversal has to be repeated with all `upgrades` pinned from the start.
+func (s *syncer) resolve(ctx context.Context, resolutions map[string]string, upgrades map[string]hashPin) bool {
+	s.done = map[string]bool{}
+	s.resolver = newDependencyResolver(s.workspaceModuleName, resolutions, upgrades, s.errorFunc, log.Log)
+	s.missing = map[string]string{}
+
+	// Modules are processed in waves: all modules of a wave are known before any of them is processed,
+	// which allows cloning and fetching all their dependencies concurrently. The dependencies are then
+	// checked and checked out one after the other, in the same order as a breadth-first traversal.
+	queue := []string{s.workspaceRoot}
+	for len(queue) > 0 {
+		wave := s.nextWave(queue)
+		queue = []string{}
+
+		s.prefetch(ctx, wave)
+		for _, node := range wave {
+			queue = append(queue, s.processModule(ctx, node)...)
+			if s.resolver.restart {
+				return false
 			}
+		}
+	}
+	return true
+}
+
+// nextWave marks all modules in `queue` that have not been processed yet as done
+// and reads their MODULE files.
+func (s *syncer) nextWave(queue []string) []syncNode {
+	wave := []syncNode{}
+	for _, modulePath := range queue {
+		if s.done[modulePath] {
+			continue
+		}
+		s.done[modulePath] = true
+
+		name := path.Base(modulePath)
+		if modulePath == s.workspaceRoot {
+			name = s.workspaceModuleName
+		}
+		moduleFile := module.ReadModuleFile(modulePath)
+		wave = append(wave, syncNode{
+			path:       modulePath,
+			name:       name,
+			moduleFile: moduleFile,
+			depNames:   dependencyNames(moduleFile),
+		})
+	}
+	return wave
+}
 
-			// Check the dependency hash against the fixed hash for that module.
-			if _, isHashPinned := pinnedHashes[name]; !isHashPinned {
-				pinnedHashes[name] = dep.Hash
+// prefetch concurrently opens or clones and then fetches all dependencies of the modules in `wave`
+// that have not been fetched before. At most --jobs modules are handled at the same time. Once the sync
+// has been interrupted, no new jobs are started.
+func (s *syncer) prefetch(ctx context.Context, wave []syncNode) {
+	jobs := []*syncFetchJob{}
+	queued := map[string]bool{}
+	for _, node := range wave {
+		for _, name := range node.depNames {
+			if _, overridden := s.overrides[name]; overridden {
+				continue
 			}
-			pinnedHash := pinnedHashes[name]
-			if dep.Hash != pinnedHash {
-				errorFunc("Dependency requires hash '%s', but hash has been pinned to '%s'.\n", dep.Hash[:7], pinnedHash[:7])
+			depModulePath := s.depModulePath(name)
+			if _, fetched := s.modules[depModulePath]; fetched || queued[depModulePath] {
+				continue
 			}
+			queued[depModulePath] = true
+			jobs = append(jobs, &syncFetchJob{path: depModulePath, dep: node.moduleFile.Dependencies[name], logger: log.NewLogger()})
+		}
+	}
+	if len(jobs) == 0 {
+		return
+	}
 
-			// Check out the pinned hash.
-			if depModule.Head() != pinnedHash {
-				log.Log("Checking out '%s'.\n", pinnedHash[:7])
-				depModule.Checkout(pinnedHash)
-				module.SetupModule(depModulePath)
+	log.IndentationLevel = 0
+	log.Log("Fetching %d module(s)\n", len(jobs))
+	log.IndentationLevel = 1
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, syncJobs)
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job *syncFetchJob) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			if ctx.Err() != nil {
+				return
 			}
-			log.Log("\n")
+			job.run()
+		}(job)
+	}
+	wg.Wait()
+
+	failed := false
+	for _, job := range jobs {
+		// Modules keep using the logger of the job, which prints right away from now on.
+		job.logger.Flush()
+		if ctx.Err() != nil {
+			continue
 		}
+		if job.err != nil && config.GetConfig().Offline {
+			// All missing modules are reported once the resolution is complete.
+			s.missing[path.Base(job.path)] = fmt.Sprintf("%s: %s", path.Base(job.path), job.err)
+			continue
+		}
+		if job.err != nil {
+			log.Error("Module '%s': %s.\n", path.Base(job.path), job.err)
+			failed = true
+			continue
+		}
+		s.modules[job.path] = job.module
+		s.created[job.path] = job.created
+	}
+	log.Log("\n")
+	checkInterrupted(ctx)
+	if failed {
+		log.Fatal("Failed to fetch all dependencies.\n")
+	}
+}
+
+func (job *syncFetchJob) run() {
+	cloneMode, err := module.GetCloneMode(job.dep.Clone)
+	if err != nil {
+		job.err = err
+		return
+	}
+
+	if job.dep.Subdir != "" {
+		job.module, job.created, job.err = module.OpenOrCloneSubdirModule(job.path, job.dep.URL, job.dep.Subdir, cloneMode, job.logger)
+		if job.err == nil {
+			_, job.err = job.module.Fetch()
+		}
+		return
+	}
+
+	// Remove the symlink left behind by an override or a subdirectory module that has been removed since the last sync.
+	if module.IsSymlink(job.path) {
+		if job.err = os.Remove(job.path); job.err != nil {
+			return
+		}
+	}
+
+	if util.DirExists(job.path) {
+		job.module, job.err = module.OpenModuleWithLogger(job.path, job.logger)
+		if job.err != nil {
+			return
+		}
+		// Versioned archives are downloaded again when their version has changed. Archives never
+		// have local changes, so nothing is lost by replacing them.
+		if !job.dep.IsVersioned() || !job.module.Type().IsArchive() || job.module.URL() == job.dep.ResolvedURL() {
+			// Make sure we have the latest changes.
+			_, job.err = job.module.Fetch()
+			return
+		}
+		job.logger.Log("Downloading version '%s'.\n", job.dep.Version)
+		if job.err = os.RemoveAll(job.path); job.err != nil {
+			return
+		}
+	}
+
+	// With --update, the pinned hash is resolved again, so it must not prevent the download.
+	expectedHash := job.dep.Hash
+	if update {
+		expectedHash = ""
+	}
+	job.module, job.err = module.CloneModule(job.path, job.dep.ResolvedURL(), job.dep.Type, expectedHash, cloneMode, job.logger)
+	if job.err != nil {
+		return
 	}
+	job.created = true
+	_, job.err = job.module.Fetch()
+}
 
+// processModule checks, pins and checks out all dependencies of `node` and returns the paths
+// of the dependency modules that still need to be processed.
+func (s *syncer) processModule(ctx context.Context, node syncNode) []string {
+	moduleName := path.Base(node.path)
 	log.IndentationLevel = 0
+	log.Log("Processing %s\n", moduleName)
+	log.IndentationLevel = 1
 
-	// Delete everything in the DEPS folder that does not belong there
-	depsDir := path.Join(workspaceRoot, util.DepsDirName)
-	content, err := os.ReadDir(depsDir)
-	if err != nil && !errors.Is(err, fs.ErrNotExist) {
-		log.Fatal("%v", err)
+	if len(node.depNames) == 0 {
+		log.Log("Has no dependencies\n\n")
+		return nil
 	}
 
-	if content != nil {
-		for _, info := range content {
-			fullPath := path.Join(depsDir, info.Name())
-			if !done[fullPath] && fullPath != workspaceModuleSymlink && info.Name() != util.WarningFileName {
-				log.Log("Deleting '%s'\n", fullPath)
-				os.RemoveAll(fullPath)
+	queue := []string{}
+	for _, name := range node.depNames {
+		checkInterrupted(ctx)
+		log.IndentationLevel = 1
+		log.Log("Depends on %s\n", name)
+		log.IndentationLevel = 2
+
+		dep := node.moduleFile.Dependencies[name]
+		depModulePath := s.depModulePath(name)
+		queue = append(queue, depModulePath)
+
+		// Overridden dependencies are symlinked to the local directory and never pinned.
+		if localPath, overridden := s.overrides[name]; overridden {
+			log.Log("Using local override '%s'.\n", localPath)
+			if err := module.LinkOverride(depModulePath, localPath); err != nil {
+				log.Fatal("Failed to override module '%s': %s.\n", name, err)
 			}
+			log.Log("\n")
+			continue
 		}
-	}
 
-	if !strict {
-		// Updated the MODULE file.
-		for name, dep := range workspaceModuleFile.Dependencies {
-			dep.Hash = pinnedHashes[name]
-			workspaceModuleFile.Dependencies[name] = dep
+		s.resolver.pinURL(node.name, name, dep)
+
+		depModule, available := s.modules[depModulePath]
+		if !available {
+			log.Warning("Module is not available offline.\n\n")
+			queue = queue[:len(queue)-1]
+			continue
 		}
-		module.WriteModuleFile(workspaceRoot, workspaceModuleFile)
+		if s.created[depModulePath] {
+			module.SetupNewModule(depModule, dep.Hash)
+			s.created[depModulePath] = false
+		}
+		s.resolver.checkModule(name, dep, depModule)
+
+		// Determine the commit hash for this dependency.
+		revs := moduleRevisions{depModule}
+		hash, ok := s.resolver.requiredHash(node.name, name, dep, node.path == s.workspaceRoot, revs)
+		if !ok || !s.checkAvailable(name, depModule, hash, node.name) {
+			queue = queue[:len(queue)-1]
+			continue
+		}
+		pinnedHash, ok := s.resolver.pinHash(node.name, name, dep, hash, revs, s.done[depModulePath])
+		if !ok {
+			// The traversal has to be restarted with the upgraded hash.
+			log.Log("\n")
+			return nil
+		}
+		if !s.checkAvailable(name, depModule, pinnedHash, node.name) {
+			queue = queue[:len(queue)-1]
+			continue
+		}
+
+		// Check out the pinned hash.
+		if depModule.Head() != pinnedHash {
+			log.Log("Checking out '%s'.\n", pinnedHash[:7])
+			depModule.Checkout(pinnedHash)
+			module.SetupModule(depModulePath)
+		}
+		log.Log("\n")
 	}
+	return queue
+}
 
-	log.Success("Done.\n")
+// checkAvailable checks in offline mode that `hash` is available locally or in the mirror.
+// Missing hashes are recorded and reported once the resolution is complete.
+func (s *syncer) checkAvailable(name string, depModule module.Module, hash, requiredBy string) bool {
+	if !config.GetConfig().Offline || depModule.HasRevision(hash) {
+		return true
+	}
+	log.Warning("Hash '%s' is not available offline.\n\n", hash[:7])
+	s.missing[name] = fmt.Sprintf("%s at '%s' (required by %s)", name, hash, formatChain(s.resolver.chains[requiredBy]))
+	return false
 }
 
 func dependencyNames(file module.ModuleFile) []string {
@@ -218,7 +546,15 @@ func dependencyNames(file module.ModuleFile) []string {
 	for name, dep := range file.Dependencies {
 		modType := module.DetermineModuleType(dep.URL, dep.Type)
 
-		if modType == module.GitModuleType {
+		if dep.Subdir != "" {
+			// Subdirectory modules are named independently of their repository.
+			if modType != module.GitModuleType {
+				log.Fatal("Dependency %s has a subdirectory, but only git dependencies can have subdirectories.\n", name)
+			}
+			if subdir := path.Clean(dep.Subdir); path.IsAbs(subdir) || subdir == "." || subdir == ".." || strings.HasPrefix(subdir, "../") {
+				log.Fatal("Subdirectory '%s' of dependency %s must be a relative path inside the repository.\n", dep.Subdir, name)
+			}
+		} else if modType == module.GitModuleType {
 			// Ensure that the dependency name matches the name of the git repo, since otherwise `module.Name()`
 			// is broken.
 			expectedName := strings.TrimSuffix(path.Base(dep.URL), ".git")
@@ -227,6 +563,10 @@ func dependencyNames(file module.ModuleFile) []string {
 			}
 		}
 
+		if dep.Clone != "" && modType != module.GitModuleType {
+			log.Fatal("Dependency %s has a clone mode, but only git dependencies can have clone modes.\n", name)
+		}
+
 		names = append(names, name)
 	}
 	return util.OrderedSlice(names)
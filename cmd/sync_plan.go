@@ -0,0 +1,403 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/daedaleanai/dbt/v3/config"
+	"github.com/daedaleanai/dbt/v3/log"
+	"github.com/daedaleanai/dbt/v3/module"
+	"github.com/daedaleanai/dbt/v3/util"
+)
+
+const (
+	syncActionClone    = "clone"
+	syncActionCheckout = "checkout"
+	syncActionNone     = "none"
+	syncActionOverride = "override"
+)
+
+// syncPlan describes the changes 'dbt sync' would make to the workspace.
+type syncPlan struct {
+	Modules    []syncPlanModule   `json:"modules"`
+	Deletions  []string           `json:"deletions"`
+	ModuleFile syncPlanModuleFile `json:"moduleFile"`
+	Errors     []string           `json:"errors"`
+}
+
+// syncPlanModule describes how a single dependency would be resolved.
+type syncPlanModule struct {
+	Name        string   `json:"name"`
+	URL         string   `json:"url"`
+	Type        string   `json:"type"`
+	Version     string   `json:"version"`
+	Hash        string   `json:"hash"`
+	CurrentHash string   `json:"currentHash,omitempty"`
+	Action      string   `json:"action"`
+	Override    string   `json:"override,omitempty"`
+	RequiredBy  []string `json:"requiredBy"`
+}
+
+// syncPlanModuleFile describes how the top-level MODULE file would be rewritten.
+type syncPlanModuleFile struct {
+	Changed bool                     `json:"changed"`
+	Hashes  []syncPlanModuleFileHash `json:"hashes"`
+	Content string                   `json:"content"`
+}
+
+type syncPlanModuleFileHash struct {
+	Name    string `json:"name"`
+	OldHash string `json:"oldHash"`
+	NewHash string `json:"newHash"`
+}
+
+// syncPlanner resolves all dependencies like 'dbt sync' does, but reads the MODULE files of the
+// dependencies from their mirrors instead of checking them out.
+type syncPlanner struct {
+	workspaceRoot       string
+	workspaceModuleName string
+	plan                syncPlan
+
+	overrides map[string]string
+	mirrors   map[string]module.Mirror
+	modules   map[string]*syncPlanModule
+
+	// Pins the URLs and hashes of all dependencies in the current traversal.
+	resolver *dependencyResolver
+
+	// Hashes that have been upgraded during any traversal.
+	upgrades map[string]hashPin
+}
+
+type syncPlanNode struct {
+	name       string
+	moduleFile module.ModuleFile
+}
+
+func runSyncDryRun(workspaceRoot, workspaceModuleName string) {
+	if config.GetConfig().Mirror == "" {
+		mirrorDir, err := os.MkdirTemp("", "dbt-mirror-")
+		if err != nil {
+			log.Fatal("Failed to create temporary mirror directory: %s.\n", err)
+		}
+		removeMirrorDir := func() { os.RemoveAll(mirrorDir) }
+		// Fatal errors exit without running deferred functions, so the directory is removed by a fatal handler as well.
+		defer log.OnFatal(removeMirrorDir)()
+		defer removeMirrorDir()
+		log.Debug("Mirrors are not configured. Using temporary mirror directory '%s'.\n", mirrorDir)
+		config.Override(func(c *config.Config) { c.Mirror = mirrorDir })
+	}
+
+	planner := syncPlanner{
+		workspaceRoot:       workspaceRoot,
+		workspaceModuleName: workspaceModuleName,
+		overrides:           module.GetOverrides(workspaceRoot),
+		mirrors:             map[string]module.Mirror{},
+		upgrades:            map[string]hashPin{},
+	}
+	plan := planner.run()
+
+	if syncJson {
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			log.Fatal("Failed to marshal sync plan: %s.\n", err)
+		}
+		fmt.Println(string(data))
+	} else {
+		printSyncPlan(plan)
+	}
+
+	if len(plan.Errors) > 0 && !ignoreErrors {
+		log.Fatal("Sync would fail. Use --ignore-errors to ignore these errors.\n")
+	}
+}
+
+func (p *syncPlanner) error(format string, a ...interface{}) {
+	p.plan.Errors = append(p.plan.Errors, fmt.Sprintf(format, a...))
+}
+
+func (p *syncPlanner) run() syncPlan {
+	workspaceModuleFile := module.ReadModuleFile(p.workspaceRoot)
+
+	visited := p.resolve(workspaceModuleFile)
+	for p.resolver.restart {
+		log.Debug("Restarting the dependency resolution with the upgraded hashes.\n")
+		visited = p.resolve(workspaceModuleFile)
+	}
+
+	for _, name := range util.OrderedKeys(p.modules) {
+		planModule := p.modules[name]
+		if planModule.Action == syncActionOverride {
+			p.plan.Modules = append(p.plan.Modules, *planModule)
+			continue
+		}
+		planModule.Hash = p.resolver.pins.hash(name)
+		if planModule.Action != syncActionClone {
+			planModule.Action = syncActionNone
+			if planModule.CurrentHash != planModule.Hash {
+				planModule.Action = syncActionCheckout
+			}
+		}
+		p.plan.Modules = append(p.plan.Modules, *planModule)
+	}
+	p.planDeletions(workspaceModuleFile, visited)
+	p.planModuleFile(workspaceModuleFile)
+	return p.plan
+}
+
+// resolve traverses the dependency graph once and returns the names of all visited modules. Like
+// 'dbt sync', it stops early if a hash has been upgraded after the dependency had already been visited.
+func (p *syncPlanner) resolve(workspaceModuleFile module.ModuleFile) map[string]bool {
+	p.plan = syncPlan{
+		Modules:   []syncPlanModule{},
+		Deletions: []string{},
+		Errors:    []string{},
+	}
+	p.modules = map[string]*syncPlanModule{}
+	p.resolver = newDependencyResolver(p.workspaceModuleName, workspaceModuleFile.Resolution, p.upgrades, p.error, log.Debug)
+
+	visited := map[string]bool{}
+	queue := []syncPlanNode{{name: p.workspaceModuleName, moduleFile: workspaceModuleFile}}
+	isWorkspace := true
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+
+		for _, name := range dependencyNames(node.moduleFile) {
+			dep := node.moduleFile.Dependencies[name]
+			hash, ok := p.resolveDependency(node.name, name, dep, isWorkspace, visited[name])
+			if p.resolver.restart {
+				return visited
+			}
+			if !ok || visited[name] {
+				continue
+			}
+			visited[name] = true
+
+			var moduleFile module.ModuleFile
+			var err error
+			if localPath, overridden := p.overrides[name]; overridden {
+				moduleFile = module.ReadModuleFile(localPath)
+			} else if planModule := p.modules[name]; planModule.Action == syncActionNone && planModule.CurrentHash == hash {
+				// The checkout is already at the pinned hash. This also covers local modules, whose
+				// source directory may have changed since they were copied.
+				moduleFile = module.ReadModuleFile(path.Join(p.workspaceRoot, util.DepsDirName, name))
+			} else {
+				moduleFile, err = p.mirrors[name].ReadModuleFile(hash)
+			}
+			if err != nil {
+				p.error("Module '%s': %s.\n", name, err)
+				continue
+			}
+			queue = append(queue, syncPlanNode{name: name, moduleFile: moduleFile})
+		}
+		isWorkspace = false
+	}
+	return visited
+}
+
+// resolveDependency performs the same checks as 'dbt sync' for a single dependency of module `parent`
+// and returns the hash the dependency is pinned to.
+func (p *syncPlanner) resolveDependency(parent, name string, dep module.Dependency, isWorkspace, visited bool) (string, bool) {
+	if localPath, overridden := p.overrides[name]; overridden {
+		return "", p.resolveOverride(parent, name, dep, localPath)
+	}
+
+	p.resolver.pinURL(parent, name, dep)
+
+	mirror, ok := p.mirrors[name]
+	if !ok {
+		var err error
+		log.Debug("Updating mirror of '%s'.\n", name)
+		mirror, err = module.GetMirror(dep.ResolvedURL(), dep.Type, dep.Subdir)
+		if err == nil {
+			err = mirror.Update()
+		}
+		if err != nil {
+			p.error("Module '%s': %s.\n", name, err)
+			return "", false
+		}
+		p.mirrors[name] = mirror
+	}
+
+	hash, ok := p.resolver.requiredHash(parent, name, dep, isWorkspace, mirror)
+	if !ok {
+		return "", false
+	}
+	pinnedHash, ok := p.resolver.pinHash(parent, name, dep, hash, mirror, visited)
+	if !ok {
+		return "", false
+	}
+
+	if planModule, exists := p.modules[name]; exists {
+		planModule.RequiredBy = append(planModule.RequiredBy, parent)
+		return pinnedHash, true
+	}
+
+	planModule := &syncPlanModule{
+		Name:       name,
+		URL:        dep.ResolvedURL(),
+		Type:       module.DetermineModuleType(dep.URL, dep.Type).String(),
+		Version:    dep.Version,
+		Action:     syncActionClone,
+		RequiredBy: []string{parent},
+	}
+	depModulePath := path.Join(p.workspaceRoot, util.DepsDirName, name)
+	if util.DirExists(depModulePath) && (!module.IsSymlink(depModulePath) || module.IsSubdirLink(depModulePath)) {
+		depModule := module.OpenModule(depModulePath)
+		planModule.CurrentHash = depModule.Head()
+		planModule.Action = syncActionNone
+		gitModule, isGit := depModule.(module.GitModule)
+		switch {
+		case dep.IsVersioned() && depModule.Type().IsArchive() && depModule.URL() != dep.ResolvedURL():
+			// Versioned archives are downloaded again when their version changes.
+			planModule.Action = syncActionClone
+		case dep.Subdir != "" && (!isGit || gitModule.Subdir() != dep.Subdir):
+			// Subdirectory modules are checked out again when their subdirectory changes.
+			planModule.Action = syncActionClone
+		default:
+			p.resolver.checkModule(name, dep, depModule)
+		}
+	}
+	p.modules[name] = planModule
+	return pinnedHash, true
+}
+
+// resolveOverride records that dependency `name` of module `parent` would be symlinked to `localPath`.
+func (p *syncPlanner) resolveOverride(parent, name string, dep module.Dependency, localPath string) bool {
+	if planModule, exists := p.modules[name]; exists {
+		planModule.RequiredBy = append(planModule.RequiredBy, parent)
+		return true
+	}
+	if !util.DirExists(localPath) || !module.IsModule(localPath) {
+		p.error("Module '%s' is overridden by '%s', which is not a module checkout.\n", name, localPath)
+		return false
+	}
+
+	planModule := &syncPlanModule{
+		Name:       name,
+		URL:        dep.URL,
+		Type:       module.DetermineModuleType(dep.URL, dep.Type).String(),
+		Version:    dep.Version,
+		Action:     syncActionOverride,
+		Override:   localPath,
+		RequiredBy: []string{parent},
+	}
+	depModulePath := path.Join(p.workspaceRoot, util.DepsDirName, name)
+	if util.DirExists(depModulePath) && (!module.IsSymlink(depModulePath) || module.IsSubdirLink(depModulePath)) && module.OpenModule(depModulePath).IsDirty() {
+		p.error("Module '%s' has local changes and cannot be replaced by the override.\n", name)
+	}
+	p.modules[name] = planModule
+	return true
+}
+
+func (p *syncPlanner) planDeletions(workspaceModuleFile module.ModuleFile, visited map[string]bool) {
+	depsDir := path.Join(p.workspaceRoot, util.DepsDirName)
+	if !util.DirExists(depsDir) {
+		return
+	}
+	content, err := os.ReadDir(depsDir)
+	if err != nil {
+		log.Fatal("Failed to read content of %s/ directory: %s.\n", util.DepsDirName, err)
+	}
+	for _, info := range content {
+		if visited[info.Name()] || info.Name() == util.WarningFileName || info.Name() == util.LockFileName || info.Name() == module.SubdirReposDirName {
+			continue
+		}
+		if info.Name() == p.workspaceModuleName && workspaceModuleFile.Layout != "cpp" {
+			continue
+		}
+		p.plan.Deletions = append(p.plan.Deletions, path.Join(depsDir, info.Name()))
+	}
+}
+
+func (p *syncPlanner) planModuleFile(workspaceModuleFile module.ModuleFile) {
+	newModuleFile := workspaceModuleFile
+	newModuleFile.Dependencies = map[string]module.Dependency{}
+	p.plan.ModuleFile.Hashes = []syncPlanModuleFileHash{}
+	for _, entry := range util.OrderedEntries(workspaceModuleFile.Dependencies) {
+		dep := entry.Value
+		if _, overridden := p.overrides[entry.Key]; !overridden && !strict {
+			dep.Hash = p.resolver.pins.hash(entry.Key)
+		}
+		if dep.Hash != entry.Value.Hash {
+			p.plan.ModuleFile.Hashes = append(p.plan.ModuleFile.Hashes, syncPlanModuleFileHash{
+				Name:    entry.Key,
+				OldHash: entry.Value.Hash,
+				NewHash: dep.Hash,
+			})
+		}
+		newModuleFile.Dependencies[entry.Key] = dep
+	}
+	if strict {
+		return
+	}
+
+	content := module.MarshalModuleFile(newModuleFile)
+	p.plan.ModuleFile.Content = string(content)
+
+	moduleFilePath := path.Join(p.workspaceRoot, util.ModuleFileName)
+	p.plan.ModuleFile.Changed = !util.FileExists(moduleFilePath) || !bytes.Equal(util.ReadFile(moduleFilePath), content)
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
+
+func printSyncPlan(plan syncPlan) {
+	log.IndentationLevel = 0
+	log.Log("Modules:\n")
+	for _, mod := range plan.Modules {
+		log.IndentationLevel = 1
+		switch mod.Action {
+		case syncActionClone:
+			log.Log("%s: clone '%s' at '%s' (%s)\n", mod.Name, mod.URL, shortHash(mod.Hash), mod.Version)
+		case syncActionOverride:
+			log.Log("%s: use local override '%s'\n", mod.Name, mod.Override)
+		case syncActionCheckout:
+			log.Log("%s: check out '%s' -> '%s' (%s)\n", mod.Name, shortHash(mod.CurrentHash), shortHash(mod.Hash), mod.Version)
+		default:
+			log.Log("%s: up to date at '%s' (%s)\n", mod.Name, shortHash(mod.Hash), mod.Version)
+		}
+	}
+
+	log.IndentationLevel = 0
+	if len(plan.Deletions) > 0 {
+		log.Log("\nDeletions:\n")
+		log.IndentationLevel = 1
+		for _, deletion := range plan.Deletions {
+			log.Log("%s\n", deletion)
+		}
+	}
+
+	log.IndentationLevel = 0
+	if strict {
+		log.Log("\n%s file: not rewritten in --strict mode\n", util.ModuleFileName)
+	} else if !plan.ModuleFile.Changed {
+		log.Log("\n%s file: unchanged\n", util.ModuleFileName)
+	} else {
+		log.Log("\n%s file: rewritten\n", util.ModuleFileName)
+		log.IndentationLevel = 1
+		for _, hash := range plan.ModuleFile.Hashes {
+			if hash.OldHash == "" {
+				log.Log("%s: pin hash '%s'\n", hash.Name, shortHash(hash.NewHash))
+			} else {
+				log.Log("%s: hash '%s' -> '%s'\n", hash.Name, shortHash(hash.OldHash), shortHash(hash.NewHash))
+			}
+		}
+	}
+
+	log.IndentationLevel = 0
+	if len(plan.Errors) > 0 {
+		log.Log("\n")
+		for _, err := range plan.Errors {
+			log.Error("%s", err)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/daedaleanai/dbt/v3/log"
+	"github.com/daedaleanai/dbt/v3/module"
+)
+
+type pinOutcome uint
+
+const (
+	// The dependency has been pinned for the first time or the requirement matches the pinned hash.
+	pinUnchanged pinOutcome = iota
+	// The pinned hash has been replaced by a newer hash that descends from it.
+	pinUpgraded
+	// The requirement has been ignored in favour of a newer pinned hash that descends from it.
+	pinKept
+	// The requirement has been ignored in favour of a resolution in the top-level MODULE file.
+	pinResolved
+	// The requirement and the pinned hash have diverged.
+	pinConflict
+)
+
+// hashPin is the hash a dependency is pinned to, together with the chain of modules
+// (starting at the top-level module) that required it.
+type hashPin struct {
+	hash  string
+	chain []string
+}
+
+// hashPins tracks the hashes all dependencies are pinned to while the dependency graph is traversed
+// and resolves conflicting requirements: if one of the required hashes descends from the other, the
+// newer hash wins. The `resolution` block of the top-level MODULE file overrides all requirements.
+type hashPins struct {
+	pins        map[string]hashPin
+	resolutions map[string]string
+}
+
+// newHashPins creates the pins for a traversal of the dependency graph. Dependencies with a resolution
+// and all `initial` pins (e.g., upgrades found by an earlier traversal) are pinned from the start.
+func newHashPins(workspaceModuleName string, resolutions map[string]string, initial map[string]hashPin) hashPins {
+	pins := hashPins{
+		pins:        map[string]hashPin{},
+		resolutions: resolutions,
+	}
+	for name, pin := range initial {
+		pins.pins[name] = pin
+	}
+	for name, hash := range resolutions {
+		pins.pins[name] = hashPin{hash: hash, chain: []string{workspaceModuleName + " (resolution)"}}
+	}
+	return pins
+}
+
+// hash returns the hash `name` is currently pinned to.
+func (p *hashPins) hash(name string) string {
+	return p.pins[name].hash
+}
+
+// pin records that the last module in `chain` requires `hash` for dependency `name`. If `comparable`,
+// isAncestor is used to order conflicting hashes.
+func (p *hashPins) pin(name, hash string, chain []string, comparable bool, isAncestor func(ancestor, rev string) bool) pinOutcome {
+	pinned, isPinned := p.pins[name]
+	if !isPinned {
+		p.pins[name] = hashPin{hash: hash, chain: chain}
+		return pinUnchanged
+	}
+	if hash == pinned.hash {
+		return pinUnchanged
+	}
+	if _, hasResolution := p.resolutions[name]; hasResolution {
+		return pinResolved
+	}
+	if comparable && isAncestor(pinned.hash, hash) {
+		p.pins[name] = hashPin{hash: hash, chain: chain}
+		return pinUpgraded
+	}
+	if comparable && isAncestor(hash, pinned.hash) {
+		return pinKept
+	}
+	return pinConflict
+}
+
+// conflictMessage describes the conflict between the pinned hash of `name` and the `hash` required by `chain`.
+func (p *hashPins) conflictMessage(name, hash string, chain []string) string {
+	pinned := p.pins[name]
+	return fmt.Sprintf(
+		"Conflicting hashes for '%s': '%s' is required by %s, but '%s' is required by %s. "+
+			"Add a resolution for '%s' to the top-level MODULE file to pick one of them.\n",
+		name, shortHash(hash), formatChain(chain), shortHash(pinned.hash), formatChain(pinned.chain), name)
+}
+
+func formatChain(chain []string) string {
+	return strings.Join(chain, " -> ")
+}
+
+func extendChain(chain []string, name string) []string {
+	result := make([]string, 0, len(chain)+1)
+	result = append(result, chain...)
+	return append(result, name)
+}
+
+// revisions gives access to the versions of a dependency, either in its checkout or in its mirror.
+type revisions interface {
+	RevParse(rev string) (string, error)
+	IsAncestor(ancestor, rev string) bool
+}
+
+// moduleRevisions gives access to the versions of a dependency in its checkout.
+type moduleRevisions struct {
+	module.Module
+}
+
+func (m moduleRevisions) RevParse(rev string) (string, error) {
+	return m.Module.RevParse(rev), nil
+}
+
+// dependencyResolver performs the checks that 'dbt sync' and 'dbt sync --dry-run' share while they
+// traverse the dependency graph once, and pins the URLs and hashes of all dependencies.
+type dependencyResolver struct {
+	// Reports a failed check.
+	errorFunc func(format string, a ...interface{})
+	// Reports the progress of the resolution.
+	logFunc func(format string, a ...interface{})
+
+	// Chains of modules through which each module has first been reached, by module name.
+	chains map[string][]string
+
+	// Pinned dependency URLs / hashes.
+	pinnedUrls map[string]string
+	pins       hashPins
+
+	// Hashes that have been upgraded during any traversal and whether the current traversal
+	// has to be restarted because of an upgrade.
+	upgrades map[string]hashPin
+	restart  bool
+}
+
+func newDependencyResolver(workspaceModuleName string, resolutions map[string]string, upgrades map[string]hashPin,
+	errorFunc, logFunc func(format string, a ...interface{})) *dependencyResolver {
+	return &dependencyResolver{
+		errorFunc:  errorFunc,
+		logFunc:    logFunc,
+		chains:     map[string][]string{workspaceModuleName: {workspaceModuleName}},
+		pinnedUrls: map[string]string{},
+		pins:       newHashPins(workspaceModuleName, resolutions, upgrades),
+		upgrades:   upgrades,
+	}
+}
+
+// pinURL checks that module `parent` requires the same URL for dependency `name` as the module
+// that has required it first.
+func (r *dependencyResolver) pinURL(parent, name string, dep module.Dependency) {
+	if _, isUrlPinned := r.pinnedUrls[name]; !isUrlPinned {
+		r.pinnedUrls[name] = dep.URL
+		log.Debug("Pinning URL to '%s'.\n", dep.URL)
+	}
+	if dep.URL != r.pinnedUrls[name] {
+		r.errorFunc("Module '%s' requires URL '%s' for '%s', but URL has been pinned to '%s'.\n", parent, dep.URL, name, r.pinnedUrls[name])
+	}
+}
+
+// checkModule checks that the on-disk module `depModule` of dependency `name` matches `dep`
+// and has no local changes.
+func (r *dependencyResolver) checkModule(name string, dep module.Dependency, depModule module.Module) {
+	if depModule.URL() != dep.ResolvedURL() {
+		r.errorFunc("Module '%s' requires URL '%s', but the on-disk module has URL '%s'.\n", name, dep.ResolvedURL(), depModule.URL())
+	}
+	if gitModule, isGit := depModule.(module.GitModule); isGit && gitModule.Subdir() != dep.Subdir {
+		r.errorFunc("Module '%s' requires subdirectory '%s', but the on-disk module has subdirectory '%s'.\n", name, dep.Subdir, gitModule.Subdir())
+	}
+	if depModule.IsDirty() {
+		r.errorFunc("Module '%s' has local changes.\n", name)
+	}
+}
+
+// requiredHash returns the hash module `parent` requires for dependency `name`. Dependencies of the
+// workspace module are resolved from their version string if they do not pin a hash or --update is used.
+func (r *dependencyResolver) requiredHash(parent, name string, dep module.Dependency, isWorkspace bool, revs revisions) (string, bool) {
+	// In --strict mode all hashes must be set in the MODULE file.
+	if strict && dep.Hash == "" {
+		r.errorFunc("Module '%s' does not pin a hash for '%s', but hashes must not be empty in --strict mode.\n", parent, name)
+	}
+
+	hash := dep.Hash
+	if (update || hash == "") && isWorkspace {
+		var err error
+		if hash, err = revs.RevParse(dep.Version); err != nil {
+			r.errorFunc("Module '%s': %s.\n", name, err)
+			return "", false
+		}
+		log.Debug("Resolved dependency version '%s' to hash '%s'.\n", dep.Version, hash[:7])
+	}
+	if hash == "" {
+		r.errorFunc("Module '%s' does not pin a hash for '%s'.\n", parent, name)
+		return "", false
+	}
+	r.logFunc("Using hash '%s' for version '%s'.\n", hash[:7], dep.Version)
+	return hash, true
+}
+
+// pinHash checks that `hash`, which module `parent` requires for dependency `name`, is part of the history
+// referenced by the version string and pins it. It returns the hash the dependency is pinned to. If the
+// pinned hash has been upgraded after the dependency has already been `visited`, the traversal has to be
+// restarted, which is reported by setting r.restart and returning false.
+func (r *dependencyResolver) pinHash(parent, name string, dep module.Dependency, hash string, revs revisions, visited bool) (string, bool) {
+	if !revs.IsAncestor(hash, dep.Version) {
+		r.errorFunc("Module '%s' requires hash '%s' for '%s', which is not an ancestor of the version string ('%s').\n", parent, hash[:7], name, dep.Version)
+	}
+
+	chain := r.chains[parent]
+	if _, reached := r.chains[name]; !reached {
+		r.chains[name] = extendChain(chain, name)
+	}
+	isGit := module.DetermineModuleType(dep.URL, dep.Type) == module.GitModuleType
+	switch r.pins.pin(name, hash, chain, isGit, revs.IsAncestor) {
+	case pinUpgraded:
+		r.logFunc("Upgrading to hash '%s', which descends from the previously pinned hash.\n", hash[:7])
+		r.upgrades[name] = hashPin{hash: hash, chain: chain}
+		if visited {
+			r.restart = true
+			return "", false
+		}
+	case pinKept:
+		r.logFunc("Keeping hash '%s', which descends from the required hash.\n", r.pins.hash(name)[:7])
+	case pinResolved:
+		r.logFunc("Using hash '%s' from the resolution in the top-level MODULE file.\n", r.pins.hash(name)[:7])
+	case pinConflict:
+		r.errorFunc("%s", r.pins.conflictMessage(name, hash, chain))
+	}
+	return r.pins.hash(name), true
+}
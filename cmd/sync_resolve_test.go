@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"testing"
+)
+
+// History used by the tests: a <- b <- c, and x, which has diverged from all of them.
+var testHistory = map[string][]string{
+	"a": {"a"},
+	"b": {"a", "b"},
+	"c": {"a", "b", "c"},
+	"x": {"x"},
+}
+
+func testIsAncestor(ancestor, rev string) bool {
+	for _, hash := range testHistory[rev] {
+		if hash == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+type testRequirement struct {
+	hash       string
+	comparable bool
+}
+
+func TestHashPinsPin(t *testing.T) {
+	tests := []struct {
+		name         string
+		resolutions  map[string]string
+		requirements []testRequirement
+		expected     []pinOutcome
+		pinned       string
+	}{
+		{"first", nil, []testRequirement{{"b", true}}, []pinOutcome{pinUnchanged}, "b"},
+		{"unchanged", nil, []testRequirement{{"b", true}, {"b", true}}, []pinOutcome{pinUnchanged, pinUnchanged}, "b"},
+		{"upgraded", nil, []testRequirement{{"a", true}, {"c", true}}, []pinOutcome{pinUnchanged, pinUpgraded}, "c"},
+		{"kept", nil, []testRequirement{{"c", true}, {"a", true}}, []pinOutcome{pinUnchanged, pinKept}, "c"},
+		{"upgraded twice", nil, []testRequirement{{"a", true}, {"b", true}, {"a", true}, {"c", true}}, []pinOutcome{pinUnchanged, pinUpgraded, pinKept, pinUpgraded}, "c"},
+		{"resolved", map[string]string{"dep": "b"}, []testRequirement{{"c", true}, {"b", true}, {"x", true}}, []pinOutcome{pinResolved, pinUnchanged, pinResolved}, "b"},
+		{"conflict", nil, []testRequirement{{"b", true}, {"x", true}}, []pinOutcome{pinUnchanged, pinConflict}, "b"},
+		{"not comparable", nil, []testRequirement{{"a", false}, {"c", false}}, []pinOutcome{pinUnchanged, pinConflict}, "a"},
+	}
+
+	for _, test := range tests {
+		pins := newHashPins("root", test.resolutions, nil)
+		for i, requirement := range test.requirements {
+			chain := []string{"root", fmt.Sprintf("module%d", i)}
+			outcome := pins.pin("dep", requirement.hash, chain, requirement.comparable, testIsAncestor)
+			if outcome != test.expected[i] {
+				t.Errorf("%s: requirement %d: expected outcome %d, got %d", test.name, i, test.expected[i], outcome)
+			}
+		}
+		if pins.hash("dep") != test.pinned {
+			t.Errorf("%s: expected pinned hash '%s', got '%s'", test.name, test.pinned, pins.hash("dep"))
+		}
+	}
+}
+
+// An upgrade that is found after the dependency's own MODULE file has been processed restarts the
+// traversal with the upgraded hash pinned from the start, so older requirements are kept back.
+func TestHashPinsRestartAfterUpgrade(t *testing.T) {
+	upgrades := map[string]hashPin{}
+
+	pins := newHashPins("root", nil, upgrades)
+	if outcome := pins.pin("dep", "a", []string{"root"}, true, testIsAncestor); outcome != pinUnchanged {
+		t.Fatalf("expected the first requirement to be pinned, got outcome %d", outcome)
+	}
+	chain := []string{"root", "other"}
+	if outcome := pins.pin("dep", "c", chain, true, testIsAncestor); outcome != pinUpgraded {
+		t.Fatalf("expected the newer requirement to upgrade the pin, got outcome %d", outcome)
+	}
+	upgrades["dep"] = hashPin{hash: "c", chain: chain}
+
+	restarted := newHashPins("root", nil, upgrades)
+	if restarted.hash("dep") != "c" {
+		t.Fatalf("expected the upgraded hash to be pinned from the start, got '%s'", restarted.hash("dep"))
+	}
+	if outcome := restarted.pin("dep", "a", []string{"root"}, true, testIsAncestor); outcome != pinKept {
+		t.Errorf("expected the older requirement to be kept back, got outcome %d", outcome)
+	}
+	if outcome := restarted.pin("dep", "c", chain, true, testIsAncestor); outcome != pinUnchanged {
+		t.Errorf("expected the upgraded requirement to match the pin, got outcome %d", outcome)
+	}
+	if restarted.hash("dep") != "c" {
+		t.Errorf("expected hash 'c' to stay pinned, got '%s'", restarted.hash("dep"))
+	}
+}
+
+func TestHashPinsResolutionOverridesUpgrades(t *testing.T) {
+	pins := newHashPins("root", map[string]string{"dep": "b"}, map[string]hashPin{"dep": {hash: "c", chain: []string{"root"}}})
+	if pins.hash("dep") != "b" {
+		t.Errorf("expected the resolution to override the upgrade, got '%s'", pins.hash("dep"))
+	}
+}
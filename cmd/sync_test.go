@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/daedaleanai/dbt/v3/util"
+)
+
+func TestSyncRewritesURLs(t *testing.T) {
+	e := newTestEnvironment(t)
+	hash := e.createRepo("lib", "version: 3\n")
+	e.writeConfig("mirror: %s\nretries: 0\nurl-rewrites:\n  https://git.invalid/: file://%s/\n", e.path("mirror"), e.path("remotes"))
+
+	canonicalURL := "https://git.invalid/lib.git"
+	workspaceRoot := e.createWorkspace("ws", dependencyModuleFile(dependency("lib", canonicalURL, "")))
+	e.mustDbt(workspaceRoot, "sync")
+
+	libPath := path.Join(workspaceRoot, util.DepsDirName, "lib")
+	if head := e.head(libPath); head != hash {
+		t.Errorf("expected 'lib' to be checked out at '%s', got '%s'", hash, head)
+	}
+	if url := e.git(libPath, "config", "remote.origin.url"); url != canonicalURL {
+		t.Errorf("expected the remote of 'lib' to keep the url '%s', got '%s'", canonicalURL, url)
+	}
+	mirrorPath := gitMirrorEntry(e.path("mirror"), canonicalURL)
+	if url := e.git(mirrorPath, "config", "remote.origin.url"); url != canonicalURL {
+		t.Errorf("expected the mirror of 'lib' to keep the url '%s', got '%s'", canonicalURL, url)
+	}
+	moduleFile := e.readFile(path.Join(workspaceRoot, util.ModuleFileName))
+	if !strings.Contains(moduleFile, "url: "+canonicalURL) || !strings.Contains(moduleFile, "hash: "+hash) {
+		t.Errorf("expected the MODULE file to pin '%s' at '%s', got:\n%s", canonicalURL, hash, moduleFile)
+	}
+
+	// Fetching uses the rewritten url as well.
+	newHash := e.commit("lib")
+	e.mustDbt(workspaceRoot, "sync", "--update")
+	if head := e.head(libPath); head != newHash {
+		t.Errorf("expected 'lib' to be checked out at '%s' after the update, got '%s'", newHash, head)
+	}
+}
+
+func TestSyncRollsBackFailedSync(t *testing.T) {
+	e := newTestEnvironment(t)
+	oldA := e.createRepo("a", "version: 3\n")
+	oldB := e.createRepo("b", "version: 3\n")
+	e.createRepo("d", "version: 3\n")
+	workspaceRoot := e.createWorkspace("ws", dependencyModuleFile(
+		dependency("a", e.url("a"), oldA),
+		dependency("b", e.url("b"), oldB)))
+	e.mustDbt(workspaceRoot, "sync")
+
+	// The new version of 'b' requires a module that does not exist, so the sync fails after 'a' and 'b'
+	// have been checked out at their new hashes and 'd' has been cloned.
+	newA := e.commit("a")
+	newB := e.commitModuleFile("b", dependencyModuleFile(dependency("c", e.url("c"), "")))
+	moduleFile := dependencyModuleFile(
+		dependency("a", e.url("a"), newA),
+		dependency("b", e.url("b"), newB),
+		dependency("d", e.url("d"), ""))
+	e.writeFile(path.Join(workspaceRoot, util.ModuleFileName), moduleFile)
+	output, err := e.dbt(workspaceRoot, "sync")
+	if err == nil {
+		t.Fatalf("expected the sync to fail, got:\n%s", output)
+	}
+	if !strings.Contains(output, "The workspace has been rolled back.") {
+		t.Errorf("expected the sync to be rolled back, got:\n%s", output)
+	}
+
+	depsDir := path.Join(workspaceRoot, util.DepsDirName)
+	if head := e.head(path.Join(depsDir, "a")); head != oldA {
+		t.Errorf("expected 'a' to be restored at '%s', got '%s'", oldA, head)
+	}
+	if head := e.head(path.Join(depsDir, "b")); head != oldB {
+		t.Errorf("expected 'b' to be restored at '%s', got '%s'", oldB, head)
+	}
+	for _, name := range []string{"c", "d"} {
+		if util.DirExists(path.Join(depsDir, name)) {
+			t.Errorf("expected '%s' to be removed", name)
+		}
+	}
+	if content := e.readFile(path.Join(workspaceRoot, util.ModuleFileName)); content != moduleFile {
+		t.Errorf("expected the MODULE file not to change, got:\n%s", content)
+	}
+}
+
+func TestSyncUsesReadOnlyMirrorLayers(t *testing.T) {
+	e := newTestEnvironment(t)
+	hashA := e.createRepo("a", "version: 3\n")
+	hashB := e.createRepo("b", "version: 3\n")
+	sharedMirror := e.path("shared-mirror")
+	localMirror := e.path("local-mirror")
+
+	// Fill the shared mirror with 'a'.
+	e.writeConfig("mirror: %s\nretries: 0\n", sharedMirror)
+	e.mustDbt(e.createWorkspace("ws1", dependencyModuleFile(dependency("a", e.url("a"), hashA))), "sync")
+
+	// Offline syncs use the entries of the read-only layer without copying them into the writable layer.
+	e.writeConfig("mirror-layers:\n- %s\n- %s\nretries: 0\n", sharedMirror, localMirror)
+	workspaceRoot := e.createWorkspace("ws2", dependencyModuleFile(dependency("a", e.url("a"), hashA)))
+	e.mustDbt(workspaceRoot, "sync", "--offline")
+	if head := e.head(path.Join(workspaceRoot, util.DepsDirName, "a")); head != hashA {
+		t.Errorf("expected 'a' to be checked out at '%s', got '%s'", hashA, head)
+	}
+	if util.DirExists(gitMirrorEntry(localMirror, e.url("a"))) {
+		t.Errorf("expected the writable mirror layer not to contain 'a'")
+	}
+
+	// New entries are only created in the writable layer.
+	workspaceRoot = e.createWorkspace("ws3", dependencyModuleFile(dependency("b", e.url("b"), hashB)))
+	e.mustDbt(workspaceRoot, "sync")
+	if !util.DirExists(gitMirrorEntry(localMirror, e.url("b"))) {
+		t.Errorf("expected the writable mirror layer to contain 'b'")
+	}
+	if util.DirExists(gitMirrorEntry(sharedMirror, e.url("b"))) {
+		t.Errorf("expected the read-only mirror layer not to contain 'b'")
+	}
+}
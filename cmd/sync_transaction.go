@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"os"
+	"path"
+
+	"github.com/daedaleanai/dbt/v3/log"
+	"github.com/daedaleanai/dbt/v3/module"
+	"github.com/daedaleanai/dbt/v3/util"
+)
+
+// syncTransaction records the state of the workspace before 'dbt sync' changes it. If the sync
+// terminates with a fatal error, all modules in the DEPS/ directory and the top-level MODULE file
+// are restored to that state, so the workspace is never left partially synced.
+type syncTransaction struct {
+	workspaceRoot string
+
+	// Modules in the DEPS/ directory before the sync started, by module path.
+	modules map[string]syncTransactionModule
+
+	// Symlinks in the DEPS/ directory before the sync started (e.g., to overridden modules), by path.
+	symlinks map[string]string
+
+	// Content of the top-level MODULE file before the sync started (nil if there was none).
+	moduleFile []byte
+
+	unregister func()
+}
+
+type syncTransactionModule struct {
+	URL       string
+	Type      string
+	Head      string
+	CloneMode module.CloneMode
+}
+
+// beginSyncTransaction records the current state of the workspace and installs the handler
+// that rolls back all changes on a fatal error.
+func beginSyncTransaction(workspaceRoot string) *syncTransaction {
+	tx := &syncTransaction{
+		workspaceRoot: workspaceRoot,
+		modules:       map[string]syncTransactionModule{},
+		symlinks:      map[string]string{},
+	}
+
+	moduleFilePath := path.Join(workspaceRoot, util.ModuleFileName)
+	if util.FileExists(moduleFilePath) {
+		tx.moduleFile = util.ReadFile(moduleFilePath)
+	}
+
+	depsDir := path.Join(workspaceRoot, util.DepsDirName)
+	content, err := os.ReadDir(depsDir)
+	if err != nil {
+		log.Fatal("Failed to read content of %s/ directory: %s.\n", util.DepsDirName, err)
+	}
+	for _, entry := range content {
+		modulePath := path.Join(depsDir, entry.Name())
+		if module.IsSymlink(modulePath) {
+			if target, err := os.Readlink(modulePath); err == nil {
+				tx.symlinks[modulePath] = target
+			}
+			continue
+		}
+		if entry.IsDir() && module.IsModule(modulePath) {
+			tx.record(modulePath)
+		}
+	}
+	// The repositories of subdirectory modules are recorded like regular modules.
+	reposDir := path.Join(depsDir, module.SubdirReposDirName)
+	repos, _ := os.ReadDir(reposDir)
+	for _, entry := range repos {
+		if repoPath := path.Join(reposDir, entry.Name()); entry.IsDir() && module.IsModule(repoPath) {
+			tx.record(repoPath)
+		}
+	}
+
+	tx.unregister = log.OnFatal(tx.rollback)
+	return tx
+}
+
+// commit discards the recorded state once the sync has completed successfully.
+func (tx *syncTransaction) commit() {
+	tx.unregister()
+}
+
+func (tx *syncTransaction) record(modulePath string) {
+	mod := module.OpenModule(modulePath)
+	recorded := syncTransactionModule{
+		URL:  mod.URL(),
+		Type: mod.Type().String(),
+		Head: mod.Head(),
+	}
+	if gitModule, isGit := mod.(module.GitModule); isGit {
+		recorded.CloneMode = gitModule.CloneMode()
+	}
+	tx.modules[modulePath] = recorded
+	log.Debug("Recorded module '%s' at '%s'.\n", modulePath, tx.modules[modulePath].Head)
+}
+
+// rollback restores all recorded modules to their previous hashes, re-creating deleted ones,
+// restores all recorded symlinks and removes all modules and symlinks that have been created by the sync.
+// It runs while the program is terminated by a fatal error, so it must not call log.Fatal itself.
+func (tx *syncTransaction) rollback() {
+	log.IndentationLevel = 0
+	log.Log("Rolling back the changes to the workspace.\n")
+	log.IndentationLevel = 1
+
+	failed := false
+	depsDir := path.Join(tx.workspaceRoot, util.DepsDirName)
+	if content, err := os.ReadDir(depsDir); err == nil {
+		for _, entry := range content {
+			modulePath := path.Join(depsDir, entry.Name())
+			if module.IsSymlink(modulePath) {
+				if module.IsOverrideLink(modulePath, tx.symlinks[modulePath]) {
+					continue
+				}
+			} else if _, existed := tx.modules[modulePath]; existed || !entry.IsDir() || entry.Name() == module.SubdirReposDirName {
+				continue
+			}
+			log.Log("Removing '%s'.\n", entry.Name())
+			if err := os.RemoveAll(modulePath); err != nil {
+				log.Error("Failed to remove '%s': %s.\n", modulePath, err)
+				failed = true
+			}
+		}
+	}
+	reposDir := path.Join(depsDir, module.SubdirReposDirName)
+	if repos, err := os.ReadDir(reposDir); err == nil {
+		for _, entry := range repos {
+			repoPath := path.Join(reposDir, entry.Name())
+			if _, existed := tx.modules[repoPath]; existed {
+				continue
+			}
+			log.Log("Removing '%s'.\n", path.Join(module.SubdirReposDirName, entry.Name()))
+			if err := os.RemoveAll(repoPath); err != nil {
+				log.Error("Failed to remove '%s': %s.\n", repoPath, err)
+				failed = true
+			}
+		}
+	}
+
+	for _, entry := range util.OrderedEntries(tx.modules) {
+		modulePath, recorded := entry.Key, entry.Value
+		if util.DirExists(modulePath) && module.IsModule(modulePath) {
+			if head, err := module.ReadHead(modulePath); err == nil && head == recorded.Head {
+				continue
+			}
+		}
+		log.Log("Restoring '%s' at '%s'.\n", path.Base(modulePath), shortHash(recorded.Head))
+		if err := module.RestoreModule(modulePath, recorded.URL, recorded.Type, recorded.Head, recorded.CloneMode); err != nil {
+			log.Error("Failed to restore '%s': %s.\n", modulePath, err)
+			failed = true
+		}
+	}
+
+	for _, entry := range util.OrderedEntries(tx.symlinks) {
+		linkPath, target := entry.Key, entry.Value
+		if module.IsSymlink(linkPath) {
+			continue
+		}
+		log.Log("Restoring symlink '%s' -> '%s'.\n", path.Base(linkPath), target)
+		if err := os.RemoveAll(linkPath); err != nil {
+			log.Error("Failed to remove '%s': %s.\n", linkPath, err)
+			failed = true
+		} else if err := os.Symlink(target, linkPath); err != nil {
+			log.Error("Failed to restore symlink '%s': %s.\n", linkPath, err)
+			failed = true
+		}
+	}
+
+	moduleFilePath := path.Join(tx.workspaceRoot, util.ModuleFileName)
+	if tx.moduleFile != nil {
+		if err := os.WriteFile(moduleFilePath, tx.moduleFile, 0664); err != nil {
+			log.Error("Failed to restore '%s': %s.\n", moduleFilePath, err)
+			failed = true
+		}
+	}
+
+	log.IndentationLevel = 0
+	if failed {
+		log.Warning("The workspace could not be rolled back completely.\n")
+	} else {
+		log.Log("The workspace has been rolled back.\n")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/daedaleanai/dbt/v3/log"
 	"gopkg.in/yaml.v2"
@@ -13,8 +14,34 @@ import (
 type Config struct {
 	Mirror       string
 	PersistFlags bool `yaml:"persist-flags"`
+	// Never access the network. Modules are only cloned and fetched from the mirror.
+	Offline bool
+	// Allow archives to contain symlinks with absolute targets or targets outside of the module directory.
+	AllowUnsafeSymlinks bool `yaml:"allow-unsafe-symlinks"`
+	// How git dependencies are cloned by default ('full', 'shallow' or 'blobless').
+	Clone string
+	// Number of times a failed network operation (e.g., a git clone or fetch or an archive download) is retried.
+	Retries *int
+	// Delay before the first retry of a failed network operation. The delay doubles with every further retry.
+	RetryDelay *time.Duration `yaml:"retry-delay"`
+	// Time limit for each network operation including all of its retries (no limit if zero).
+	NetworkTimeout time.Duration `yaml:"network-timeout"`
+	// Replacements for url prefixes that are applied when accessing the network (like git's 'insteadOf').
+	// MODULE files and mirrors keep using the original urls.
+	UrlRewrites map[string]string `yaml:"url-rewrites"`
+	// Minimum time between two updates of a git mirror before fetching a module that uses it
+	// (the mirror is updated before every fetch if zero).
+	MirrorRefresh *time.Duration `yaml:"mirror-refresh-interval"`
+	// Mirror directories that are searched for mirror entries in order. All layers except for the last one
+	// are read-only (e.g., a shared mirror on a network volume). The last layer is the writable mirror,
+	// which replaces the 'mirror' option.
+	MirrorLayers []string `yaml:"mirror-layers"`
 }
 
+const defaultRetries = 3
+const defaultRetryDelay = time.Second
+const defaultMirrorRefreshInterval = 10 * time.Minute
+
 var environment map[string]string
 var config *Config
 
@@ -70,6 +97,14 @@ func loadConfiguration() Config {
 		return config
 	}
 
+	if len(config.MirrorLayers) > 0 {
+		writableLayer := config.MirrorLayers[len(config.MirrorLayers)-1]
+		if config.Mirror != "" && config.Mirror != writableLayer {
+			log.Warning("The configuration sets both 'mirror' and 'mirror-layers'. Using the last mirror layer '%s' as the writable mirror.\n", writableLayer)
+		}
+		config.Mirror = writableLayer
+	}
+
 	log.Debug("Loaded configuration from `%s`\n", configFilePath)
 	log.Debug("Running with configuration: %+v\n", config)
 	return config
@@ -83,3 +118,70 @@ func GetConfig() Config {
 
 	return *config
 }
+
+// NetworkRetries returns the number of times a failed network operation is retried.
+func (c Config) NetworkRetries() int {
+	if c.Retries == nil {
+		return defaultRetries
+	}
+	return *c.Retries
+}
+
+// NetworkRetryDelay returns the delay before the first retry of a failed network operation.
+func (c Config) NetworkRetryDelay() time.Duration {
+	if c.RetryDelay == nil {
+		return defaultRetryDelay
+	}
+	return *c.RetryDelay
+}
+
+// MirrorRefreshInterval returns the minimum time between two updates of a git mirror before fetching.
+func (c Config) MirrorRefreshInterval() time.Duration {
+	if c.MirrorRefresh == nil {
+		return defaultMirrorRefreshInterval
+	}
+	return *c.MirrorRefresh
+}
+
+// ReadOnlyMirrors returns the read-only mirror layers in the order they are searched.
+func (c Config) ReadOnlyMirrors() []string {
+	if len(c.MirrorLayers) < 2 {
+		return nil
+	}
+	return c.MirrorLayers[:len(c.MirrorLayers)-1]
+}
+
+// RewriteURL replaces the longest prefix of `url` that has a url rewrite by its replacement.
+func (c Config) RewriteURL(url string) string {
+	longestPrefix := ""
+	for prefix := range c.UrlRewrites {
+		if strings.HasPrefix(url, prefix) && len(prefix) > len(longestPrefix) {
+			longestPrefix = prefix
+		}
+	}
+	if longestPrefix == "" {
+		return url
+	}
+	rewritten := c.UrlRewrites[longestPrefix] + strings.TrimPrefix(url, longestPrefix)
+	log.Debug("Rewriting url '%s' to '%s'.\n", url, rewritten)
+	return rewritten
+}
+
+// GoEnvironment returns the environment for running the go tool. In offline mode, the go tool must
+// not download any modules, so GOPROXY is turned off and -mod=mod is added to GOFLAGS, which lets the
+// go tool resolve modules from the module cache. All other GOFLAGS are kept.
+func GoEnvironment() []string {
+	env := os.Environ()
+	if !GetConfig().Offline {
+		return env
+	}
+	goFlags := append(strings.Fields(os.Getenv("GOFLAGS")), "-mod=mod")
+	return append(env, "GOFLAGS="+strings.Join(goFlags, " "), "GOPROXY=off")
+}
+
+// Override applies `f` to the configuration returned by all subsequent calls to GetConfig.
+// It is used to apply command-line flags on top of the configuration file.
+func Override(f func(*Config)) {
+	GetConfig()
+	f(config)
+}
@@ -0,0 +1,34 @@
+package config
+
+import "testing"
+
+func TestRewriteURL(t *testing.T) {
+	c := Config{UrlRewrites: map[string]string{
+		"https://github.com/":         "https://proxy.example.com/github/",
+		"https://github.com/company/": "git@git.example.com:company/",
+		"https://example.com/archive": "file:///srv/archive",
+	}}
+
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"https://github.com/other/repo.git", "https://proxy.example.com/github/other/repo.git"},
+		{"https://github.com/company/repo.git", "git@git.example.com:company/repo.git"},
+		{"https://github.com/company", "https://proxy.example.com/github/company"},
+		{"https://example.com/archives/lib.tar.gz", "file:///srv/archives/lib.tar.gz"},
+		{"https://gitlab.com/company/repo.git", "https://gitlab.com/company/repo.git"},
+		{"http://github.com/company/repo.git", "http://github.com/company/repo.git"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if rewritten := c.RewriteURL(test.url); rewritten != test.expected {
+			t.Errorf("expected '%s' to be rewritten to '%s', got '%s'", test.url, test.expected, rewritten)
+		}
+	}
+
+	if rewritten := (Config{}).RewriteURL("https://github.com/repo.git"); rewritten != "https://github.com/repo.git" {
+		t.Errorf("expected the url not to be rewritten without url rewrites, got '%s'", rewritten)
+	}
+}
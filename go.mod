@@ -4,6 +4,8 @@ go 1.23.0
 
 require (
 	github.com/daedaleanai/cobra v1.1.2
+	github.com/klauspost/compress v1.17.11
+	github.com/ulikunitz/xz v0.5.17
 	golang.org/x/exp v0.0.0-20231006140011-7918f672742d
 	golang.org/x/tools v0.34.0
 	gopkg.in/yaml.v2 v2.4.0
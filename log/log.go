@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 // Verbose controls whether debug messages are being printed.
@@ -19,7 +21,15 @@ var noColorEnv bool = false
 // IndentationLevel controls the amount of indentation of log messages.
 var IndentationLevel = 0
 
-var errorOccured = false
+var errorOccured atomic.Bool
+
+// outputMutex serializes writes of messages logged from concurrently running goroutines.
+var outputMutex sync.Mutex
+
+// fatalHandlers are run by Fatal before the program terminates.
+var fatalHandlers []func()
+var fatalHandlersMutex sync.Mutex
+var fatalOccured atomic.Bool
 
 type Color uint
 
@@ -60,40 +70,148 @@ func GetColorString(color Color) string {
 
 // ErrorOccured reports whether any errors have occured.
 func ErrorOccured() bool {
-	return errorOccured
+	return errorOccured.Load()
+}
+
+func printf(format string, a ...interface{}) {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	fmt.Fprintf(os.Stderr, format, a...)
+}
+
+// Logger prints the same messages as the package-level functions, but collects them until Flush is called,
+// so that the output of goroutines that run concurrently can be printed one after the other. The methods of
+// a nil *Logger print right away, like the package-level functions.
+type Logger struct {
+	mutex   sync.Mutex
+	output  strings.Builder
+	flushed bool
+}
+
+// std prints all messages of the package-level functions right away.
+var std *Logger
+
+// NewLogger returns a logger that collects all messages until Flush is called.
+func NewLogger() *Logger {
+	return &Logger{}
+}
+
+// Flush prints all messages collected so far. Afterwards, messages are printed right away.
+func (l *Logger) Flush() {
+	if l == nil {
+		return
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	printf("%s", l.output.String())
+	l.output.Reset()
+	l.flushed = true
+}
+
+func (l *Logger) printf(format string, a ...interface{}) {
+	if l != nil {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		if !l.flushed {
+			fmt.Fprintf(&l.output, format, a...)
+			return
+		}
+	}
+	printf(format, a...)
+}
+
+// Log prints an indented and formatted message.
+func (l *Logger) Log(format string, a ...interface{}) {
+	l.printf(strings.Repeat("  ", IndentationLevel)+format, a...)
+}
+
+// Debug prints an indented and formatted debug message if verbose output is selected.
+func (l *Logger) Debug(format string, a ...interface{}) {
+	if Verbose {
+		l.printf(strings.Repeat("  ", IndentationLevel)+GetColorString(ColorBlue)+"Debug: "+GetColorString(ColorReset)+format, a...)
+	}
+}
+
+// Success prints an indented and formatted success message.
+func (l *Logger) Success(format string, a ...interface{}) {
+	l.printf(strings.Repeat("  ", IndentationLevel)+GetColorString(ColorGreen)+"Success: "+GetColorString(ColorReset)+format, a...)
+}
+
+// Warning prints an indented and formatted warning.
+func (l *Logger) Warning(format string, a ...interface{}) {
+	l.printf(strings.Repeat("  ", IndentationLevel)+GetColorString(ColorYellow)+"Warning: "+GetColorString(ColorReset)+format, a...)
+}
+
+// Error prints an indented and formatted error message.
+func (l *Logger) Error(format string, a ...interface{}) {
+	errorOccured.Store(true)
+	l.printf(strings.Repeat("  ", IndentationLevel)+GetColorString(ColorRed)+"Error: "+GetColorString(ColorReset)+format, a...)
 }
 
 // Log prints an indented and formatted message to os.Stdout.
 func Log(format string, a ...interface{}) {
-	fmt.Fprintf(os.Stderr, strings.Repeat("  ", IndentationLevel)+format, a...)
+	std.Log(format, a...)
 }
 
 // Debug prints an indented and formatted debug message to os.Stdout if verbose output is selected.
 func Debug(format string, a ...interface{}) {
-	if Verbose {
-		fmt.Fprintf(os.Stderr, strings.Repeat("  ", IndentationLevel)+GetColorString(ColorBlue)+"Debug: "+GetColorString(ColorReset)+format, a...)
-	}
+	std.Debug(format, a...)
 }
 
 // Success prints an indented and formatted success message to os.Stdout.
 func Success(format string, a ...interface{}) {
-	fmt.Fprintf(os.Stderr, strings.Repeat("  ", IndentationLevel)+GetColorString(ColorGreen)+"Success: "+GetColorString(ColorReset)+format, a...)
+	std.Success(format, a...)
 }
 
 // Warning prints an indented and formatted warning to os.Stdout.
 func Warning(format string, a ...interface{}) {
-	fmt.Fprintf(os.Stderr, strings.Repeat("  ", IndentationLevel)+GetColorString(ColorYellow)+"Warning: "+GetColorString(ColorReset)+format, a...)
+	std.Warning(format, a...)
 }
 
 // Error prints an indented and formatted error message to os.Stdout.
 func Error(format string, a ...interface{}) {
-	errorOccured = true
-	fmt.Fprintf(os.Stderr, strings.Repeat("  ", IndentationLevel)+GetColorString(ColorRed)+"Error: "+GetColorString(ColorReset)+format, a...)
+	std.Error(format, a...)
 }
 
-// Fatal prints an indented and formatted error message to os.Stdout and terminates the program.
+// OnFatal registers a handler that is run by Fatal before the program terminates.
+// Handlers run in reverse order of their registration. If a handler calls Fatal itself, the remaining
+// handlers are skipped. The returned function unregisters the handler.
+func OnFatal(handler func()) func() {
+	fatalHandlersMutex.Lock()
+	defer fatalHandlersMutex.Unlock()
+	fatalHandlers = append(fatalHandlers, handler)
+	index := len(fatalHandlers) - 1
+	return func() {
+		fatalHandlersMutex.Lock()
+		defer fatalHandlersMutex.Unlock()
+		if index < len(fatalHandlers) {
+			fatalHandlers[index] = nil
+		}
+	}
+}
+
+func runFatalHandlers() {
+	fatalHandlersMutex.Lock()
+	handlers := fatalHandlers
+	fatalHandlers = nil
+	fatalHandlersMutex.Unlock()
+
+	for i := len(handlers) - 1; i >= 0; i-- {
+		if handlers[i] != nil {
+			handlers[i]()
+		}
+	}
+}
+
+// Fatal prints an indented and formatted error message to os.Stdout, runs all handlers registered
+// with OnFatal and terminates the program. Fatal must only be called from the main goroutine, since
+// other goroutines keep running while the handlers run.
 func Fatal(format string, a ...interface{}) {
 	Error(format, a...)
-	fmt.Fprintf(os.Stderr, GetColorString(ColorRed)+"A fatal error occured. Exiting..."+GetColorString(ColorReset)+"\n")
+	// A handler that calls Fatal itself terminates the program right away.
+	if fatalOccured.CompareAndSwap(false, true) {
+		runFatalHandlers()
+	}
+	printf(GetColorString(ColorRed) + "A fatal error occured. Exiting..." + GetColorString(ColorReset) + "\n")
 	os.Exit(1)
 }
@@ -2,6 +2,7 @@ package manifest
 
 import (
 	"fmt"
+	"reflect"
 
 	"github.com/daedaleanai/dbt/v3/log"
 	"github.com/daedaleanai/dbt/v3/module"
@@ -10,7 +11,17 @@ import (
 
 type Module struct {
 	Name, Url, Hash, Type string
-	Dirty                 bool
+	// Subdirectory of the git repository that contains the module (empty if the module is the whole repository).
+	Subdir string `yaml:",omitempty"`
+	Dirty  bool
+	// Set if the module has been replaced by a local directory in the MODULE.local file.
+	Overridden bool `yaml:",omitempty"`
+	// Checked out git submodules of the module.
+	Submodules []Submodule `yaml:",omitempty"`
+}
+
+type Submodule struct {
+	Path, Url, Hash string
 }
 
 type DbtVersion struct {
@@ -34,6 +45,14 @@ type ModuleDiff struct {
 	DiscardedCommits []Commit
 	// May be null if no common ancestor is found
 	FirstCommonAncestor *Commit
+
+	// Submodules are matched by their paths.
+	AddedSubmodules, RemovedSubmodules []Submodule
+	ModifiedSubmodules                 []SubmoduleDiff
+}
+
+type SubmoduleDiff struct {
+	New, Old Submodule
 }
 
 type DiffResult struct {
@@ -51,7 +70,9 @@ func (c Commit) String() string {
 	return fmt.Sprintf("%s: %s - %s", c.Id[:7], c.Title, c.AuthorName)
 }
 
-func Generate(modules util.OrderedMap[string, module.Module], allowUncommittedChanges bool) (Manifest, error) {
+// Generate creates a manifest of `modules`. `overrides` maps the names of modules that are replaced by
+// local directories to these directories.
+func Generate(modules util.OrderedMap[string, module.Module], overrides map[string]string, allowUncommittedChanges bool) (Manifest, error) {
 	dbtVersion := util.VersionTriplet()
 	manifest := Manifest{
 		DbtVersion: DbtVersion{
@@ -61,7 +82,13 @@ func Generate(modules util.OrderedMap[string, module.Module], allowUncommittedCh
 		},
 	}
 
-	for _, mod := range modules.Values() {
+	for _, entry := range modules.Entries() {
+		mod := entry.Value
+		localPath, overridden := overrides[entry.Key]
+		if overridden {
+			log.Warning("Module %q is overridden by local directory %q\n", entry.Key, localPath)
+		}
+
 		dirty := mod.IsDirty()
 		if dirty {
 			message := fmt.Sprintf("Module %q has uncommitted changes", mod.Name())
@@ -72,13 +99,29 @@ func Generate(modules util.OrderedMap[string, module.Module], allowUncommittedCh
 			}
 		}
 
-		manifest.Modules = append(manifest.Modules, Module{
-			Name:  mod.Name(),
-			Url:   mod.URL(),
-			Hash:  mod.Head(),
-			Type:  mod.Type().String(),
-			Dirty: dirty,
-		})
+		manifestModule := Module{
+			Name:       mod.Name(),
+			Url:        mod.URL(),
+			Hash:       mod.Head(),
+			Type:       mod.Type().String(),
+			Dirty:      dirty,
+			Overridden: overridden,
+		}
+		if gitMod, isGit := mod.(module.GitModule); isGit {
+			manifestModule.Subdir = gitMod.Subdir()
+			submodules, err := gitMod.Submodules()
+			if err != nil {
+				return manifest, fmt.Errorf("Module %q: %s", mod.Name(), err)
+			}
+			for _, submodule := range submodules {
+				manifestModule.Submodules = append(manifestModule.Submodules, Submodule{
+					Path: submodule.Path,
+					Url:  submodule.URL,
+					Hash: submodule.Hash,
+				})
+			}
+		}
+		manifest.Modules = append(manifest.Modules, manifestModule)
 	}
 
 	return manifest, nil
@@ -101,6 +144,30 @@ func parseCommitFromRef(gitMod module.GitModule, ref string) (Commit, error) {
 	return result, nil
 }
 
+func diffSubmodules(result *ModuleDiff) {
+	findSubmoduleByPath := func(path string, submodules []Submodule) (Submodule, bool) {
+		for _, submodule := range submodules {
+			if submodule.Path == path {
+				return submodule, true
+			}
+		}
+		return Submodule{}, false
+	}
+
+	for _, submodule := range result.New.Submodules {
+		if oldSubmodule, found := findSubmoduleByPath(submodule.Path, result.Old.Submodules); !found {
+			result.AddedSubmodules = append(result.AddedSubmodules, submodule)
+		} else if submodule != oldSubmodule {
+			result.ModifiedSubmodules = append(result.ModifiedSubmodules, SubmoduleDiff{New: submodule, Old: oldSubmodule})
+		}
+	}
+	for _, submodule := range result.Old.Submodules {
+		if _, found := findSubmoduleByPath(submodule.Path, result.New.Submodules); !found {
+			result.RemovedSubmodules = append(result.RemovedSubmodules, submodule)
+		}
+	}
+}
+
 func diffModule(newMod, oldMod Module) (ModuleDiff, error) {
 	result := ModuleDiff{
 		New:                 newMod,
@@ -109,6 +176,7 @@ func diffModule(newMod, oldMod Module) (ModuleDiff, error) {
 		DiscardedCommits:    []Commit{},
 		FirstCommonAncestor: nil,
 	}
+	diffSubmodules(&result)
 
 	oldModType, found := module.ParseModuleTypeString(oldMod.Type)
 	if !found {
@@ -193,7 +261,7 @@ func Diff(newManifest, oldManifest Manifest) (DiffResult, error) {
 	// A second pass through the old modules will allow us to determine which modules have been removed
 	for _, mod := range newManifest.Modules {
 		if matchingOldModule, found := findModByName(mod.Name, oldManifest.Modules); found {
-			if mod != matchingOldModule {
+			if !reflect.DeepEqual(mod, matchingOldModule) {
 				result.Differ = true
 				moduleDiff, err := diffModule(mod, matchingOldModule)
 				if err != nil {
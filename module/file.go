@@ -1,10 +1,14 @@
 package module
 
 import (
+	"fmt"
+	"os"
 	"path"
+	"strings"
 
 	"github.com/daedaleanai/dbt/v3/log"
 	"github.com/daedaleanai/dbt/v3/util"
+	"gopkg.in/yaml.v2"
 )
 
 type moduleFileVersion struct {
@@ -18,6 +22,25 @@ type Dependency struct {
 	Version string
 	Hash    string
 	Type    string
+	// Subdirectory of a git repository that contains the module (e.g., for modules in a monorepo).
+	Subdir string `yaml:",omitempty"`
+	// How a git dependency is cloned ('full', 'shallow' or 'blobless'). Defaults to the global setting.
+	Clone string `yaml:",omitempty"`
+}
+
+// VersionPlaceholder is replaced by the version of a dependency in the URL of an archive dependency
+// (e.g., 'https://host/lib-{version}.tar.gz').
+const VersionPlaceholder = "{version}"
+
+// IsVersioned reports whether the URL of the dependency is a template that contains the version placeholder.
+func (d Dependency) IsVersioned() bool {
+	return strings.Contains(d.URL, VersionPlaceholder)
+}
+
+// ResolvedURL returns the URL the dependency is downloaded from, i.e., its URL with the version
+// placeholder replaced by the version of the dependency.
+func (d Dependency) ResolvedURL() string {
+	return strings.ReplaceAll(d.URL, VersionPlaceholder, d.Version)
 }
 
 type ModuleFile struct {
@@ -26,6 +49,8 @@ type ModuleFile struct {
 	Dependencies map[string]Dependency
 	Flags        map[string]string
 	PersistFlags *bool `yaml:"persist-flags,omitempty"`
+	// Hashes that override all requirements for a dependency. Only used in the top-level MODULE file.
+	Resolution map[string]string `yaml:"resolution,omitempty"`
 }
 
 // MODULE file version 2
@@ -73,39 +98,84 @@ func ReadModuleFile(modulePath string) ModuleFile {
 	moduleFilePath := path.Join(modulePath, util.ModuleFileName)
 	if !util.FileExists(moduleFilePath) {
 		log.Debug("Module has no %s file.\n", util.ModuleFileName)
-		return ModuleFile{
-			Version:      util.ModuleSyntaxVersion,
-			Dependencies: map[string]Dependency{},
-		}
+		return emptyModuleFile()
+	}
+
+	moduleFile, err := ParseModuleFile(util.ReadFile(moduleFilePath))
+	if err != nil {
+		log.Fatal("Failed to parse %s file '%s': %s.\n", util.ModuleFileName, moduleFilePath, err)
+	}
+	return moduleFile
+}
+
+// tryReadModuleFile reads the MODULE file of the module at `modulePath` like ReadModuleFile, but returns
+// an error if the file cannot be read or parsed.
+func tryReadModuleFile(modulePath string) (ModuleFile, error) {
+	moduleFilePath := path.Join(modulePath, util.ModuleFileName)
+	if !util.FileExists(moduleFilePath) {
+		log.Debug("Module has no %s file.\n", util.ModuleFileName)
+		return emptyModuleFile(), nil
+	}
+
+	data, err := os.ReadFile(moduleFilePath)
+	if err != nil {
+		return ModuleFile{}, err
+	}
+	moduleFile, err := ParseModuleFile(data)
+	if err != nil {
+		return ModuleFile{}, fmt.Errorf("failed to parse %s file '%s': %s", util.ModuleFileName, moduleFilePath, err)
 	}
+	return moduleFile, nil
+}
 
+// ParseModuleFile parses the content of a MODULE file of any supported syntax version.
+func ParseModuleFile(data []byte) (ModuleFile, error) {
 	// Check MODULE file version.
 	var moduleFileVersion moduleFileVersion
-	util.ReadYaml(moduleFilePath, &moduleFileVersion)
+	if err := yaml.Unmarshal(data, &moduleFileVersion); err != nil {
+		return ModuleFile{}, err
+	}
 
 	switch moduleFileVersion.Version {
 	case 1:
-		return readV1ModuleFile(moduleFilePath)
+		return parseV1ModuleFile(data)
 	case 2:
-		return readV2ModuleFile(moduleFilePath)
+		return parseV2ModuleFile(data)
 	case 3:
-		return readV3ModuleFile(moduleFilePath)
+		return parseV3ModuleFile(data)
 	default:
-		log.Fatal("MODULE file has unknown syntax version %d. It is either a mistake in the file or a newer version of dbt is required.\n", moduleFileVersion.Version)
-		return ModuleFile{}
+		return ModuleFile{}, fmt.Errorf("MODULE file has unknown syntax version %d. It is either a mistake in the file or a newer version of dbt is required", moduleFileVersion.Version)
 	}
 }
 
 // WriteModuleFile serializes and writes a Module's Dependencies to a MODULE file.
 func WriteModuleFile(modulePath string, moduleFile ModuleFile) {
-	moduleFile.Version = util.ModuleSyntaxVersion
 	moduleFilePath := path.Join(modulePath, util.ModuleFileName)
-	util.WriteYaml(moduleFilePath, moduleFile)
+	util.WriteFile(moduleFilePath, MarshalModuleFile(moduleFile))
+}
+
+// MarshalModuleFile serializes a Module's Dependencies in the format written to MODULE files.
+func MarshalModuleFile(moduleFile ModuleFile) []byte {
+	moduleFile.Version = util.ModuleSyntaxVersion
+	data, err := yaml.Marshal(moduleFile)
+	if err != nil {
+		log.Fatal("Failed to marshal %s file: %s.\n", util.ModuleFileName, err)
+	}
+	return data
+}
+
+func emptyModuleFile() ModuleFile {
+	return ModuleFile{
+		Version:      util.ModuleSyntaxVersion,
+		Dependencies: map[string]Dependency{},
+	}
 }
 
-func readV1ModuleFile(path string) ModuleFile {
+func parseV1ModuleFile(data []byte) (ModuleFile, error) {
 	v1ModuleFile := v1ModuleFile{}
-	util.ReadYaml(path, &v1ModuleFile)
+	if err := yaml.Unmarshal(data, &v1ModuleFile); err != nil {
+		return ModuleFile{}, err
+	}
 
 	moduleFile := ModuleFile{
 		Version:      util.ModuleSyntaxVersion,
@@ -119,12 +189,14 @@ func readV1ModuleFile(path string) ModuleFile {
 			Hash:    dep.Version.Hash,
 		}
 	}
-	return moduleFile
+	return moduleFile, nil
 }
 
-func readV2ModuleFile(path string) ModuleFile {
+func parseV2ModuleFile(data []byte) (ModuleFile, error) {
 	v2ModuleFile := v2ModuleFile{}
-	util.ReadYaml(path, &v2ModuleFile)
+	if err := yaml.Unmarshal(data, &v2ModuleFile); err != nil {
+		return ModuleFile{}, err
+	}
 
 	moduleFile := ModuleFile{
 		Version:      util.ModuleSyntaxVersion,
@@ -139,17 +211,19 @@ func readV2ModuleFile(path string) ModuleFile {
 			Hash:    v2ModuleFile.PinnedDependencies[name].Hash,
 		}
 	}
-	return moduleFile
+	return moduleFile, nil
 }
 
-func readV3ModuleFile(path string) ModuleFile {
+func parseV3ModuleFile(data []byte) (ModuleFile, error) {
 	moduleFile := ModuleFile{}
-	util.ReadYaml(path, &moduleFile)
+	if err := yaml.Unmarshal(data, &moduleFile); err != nil {
+		return ModuleFile{}, err
+	}
 
 	// YAML decoding can produce `nil`` maps if the key is present in the YAML file
 	// but has no entries.
 	if moduleFile.Dependencies == nil {
 		moduleFile.Dependencies = map[string]Dependency{}
 	}
-	return moduleFile
+	return moduleFile, nil
 }
@@ -2,11 +2,15 @@ package module
 
 import (
 	"bytes"
-	"crypto/sha256"
+	"context"
 	"fmt"
+	"os"
 	"os/exec"
 	"path"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/daedaleanai/dbt/v3/config"
 	"github.com/daedaleanai/dbt/v3/log"
@@ -17,66 +21,427 @@ import (
 type GitModule struct {
 	path   string
 	mirror *GitMirror
+	// Subdirectory of the repository that contains the module (empty if the module is the whole repository).
+	subdir string
+	// Logger for the messages of the module (nil prints them right away).
+	logger *log.Logger
 }
 
 // GitMirror is a bare repository that backs a GitModule
 type GitMirror struct {
 	path string
+	// Subdirectory of the repository that contains the module.
+	subdir string
+	// Whether the mirror is in a read-only mirror layer.
+	readOnly bool
+	// Logger for the messages of the mirror (nil prints them right away).
+	logger *log.Logger
 }
 
-// Obtains a mirror for a git repository if the global mirror directory has been set up
-func getOrCreateGitMirror(url string) (*GitMirror, error) {
+// CloneMode determines how much of a git repository is cloned.
+type CloneMode string
+
+const (
+	// FullClone clones the complete history of the repository.
+	FullClone CloneMode = "full"
+	// ShallowClone only clones the tips of all branches. Older commits are fetched on demand.
+	ShallowClone CloneMode = "shallow"
+	// BloblessClone clones all commits, but only fetches the contents of files when they are checked out.
+	BloblessClone CloneMode = "blobless"
+)
+
+// Messages of git errors that are not resolved by running the command again (e.g., a missing repository,
+// missing credentials or a commit that the remote does not have). Only complete messages of git and ssh are
+// matched, since similar messages of proxies and servers might be transient.
+var permanentGitErrors = []*regexp.Regexp{
+	regexp.MustCompile(`(?m)^fatal: repository '.*' (not found|does not exist)$`),
+	regexp.MustCompile(`(?m)^fatal: '.*' does not appear to be a git repository$`),
+	regexp.MustCompile(`(?m)^fatal: Authentication failed for '.*'$`),
+	regexp.MustCompile(`(?m)^fatal: could not read (Username|Password) for '.*'`),
+	regexp.MustCompile(`(?m)^.*: Permission denied \(publickey.*\)\.?$`),
+	regexp.MustCompile(`(?m)^fatal: couldn't find remote ref .*$`),
+	regexp.MustCompile(`(?m)^fatal: (remote error: |git )?upload-pack: not our ref [0-9a-f]+$`),
+	regexp.MustCompile(`(?m)^error: Server does not allow request for unadvertised object [0-9a-f]+$`),
+}
+
+// Steps by which the history of a shallow clone is deepened while looking for an ancestor of a commit.
+// The complete history is never fetched, since that would defeat the purpose of shallow clones.
+var deepenSteps = []int{100, 1000}
+
+// GetCloneMode returns the clone mode for the `clone` setting `mode` of a dependency. Dependencies
+// without a setting use the clone mode from the configuration, which defaults to full clones.
+func GetCloneMode(mode string) (CloneMode, error) {
+	if mode == "" {
+		mode = config.GetConfig().Clone
+	}
+	switch CloneMode(mode) {
+	case "", FullClone:
+		return FullClone, nil
+	case ShallowClone, BloblessClone:
+		return CloneMode(mode), nil
+	}
+	return "", fmt.Errorf("unknown clone mode '%s' (must be one of '%s', '%s' or '%s')", mode, FullClone, ShallowClone, BloblessClone)
+}
+
+func (c CloneMode) cloneFlags() []string {
+	switch c {
+	case ShallowClone:
+		return []string{"--depth", "1", "--no-single-branch"}
+	case BloblessClone:
+		return []string{"--filter=blob:none"}
+	}
+	return nil
+}
+
+// Submodule is a git submodule that is checked out inside of a GitModule.
+type Submodule struct {
+	// Path of the submodule relative to the root of the repository.
+	Path string
+	URL  string
+	// Commit the submodule is checked out at.
+	Hash string
+}
+
+// Obtains a mirror for a git repository if the global mirror directory has been set up.
+// All messages are printed to `logger`.
+func getOrCreateGitMirror(url string, logger *log.Logger) (*GitMirror, error) {
 	configuration := config.GetConfig()
 	if configuration.Mirror == "" {
-		log.Debug("Mirrors are not configured.\n")
+		logger.Debug("Mirrors are not configured.\n")
 		return nil, nil
 	}
 
-	urlHash := sha256.Sum256([]byte(url))
-	urlHashString := fmt.Sprintf("git-%x", urlHash[:])
-	mirrorPath := path.Join(configuration.Mirror, urlHashString)
+	mirrorPath := mirrorEntryPath(gitMirrorPrefix, url)
+	if !util.DirExists(mirrorPath) {
+		if readOnlyPath, found := findReadOnlyMirrorEntry(gitMirrorPrefix, url); found {
+			logger.Debug("Mirror of '%s' found in read-only mirror layer at '%s'.\n", url, readOnlyPath)
+			return &GitMirror{path: readOnlyPath, readOnly: true, logger: logger}, nil
+		}
+	}
+	logger.Debug("Looking for mirror of '%s' in directory '%s'.\n", url, mirrorPath)
+	if recentlyUsed(mirrorPath) {
+		logger.Debug("Mirror found at '%s'.\n", mirrorPath)
+		return &GitMirror{path: mirrorPath, logger: logger}, nil
+	}
 
-	log.Debug("Looking for mirror of '%s' in directory '%s'.\n", url, mirrorPath)
+	// Wait for other processes that are creating the same mirror.
+	lock, err := lockMirror(mirrorPath, url)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
 
 	if util.DirExists(mirrorPath) {
-		log.Debug("Mirror found at '%s'.\n", mirrorPath)
-		return &GitMirror{path: mirrorPath}, nil
+		logger.Debug("Mirror found at '%s'.\n", mirrorPath)
+		recordMirrorUsage(mirrorPath, url, logger)
+		return &GitMirror{path: mirrorPath, logger: logger}, nil
+	}
+	if configuration.Offline {
+		logger.Debug("Not creating mirror in offline mode.\n")
+		return nil, nil
 	}
 
-	util.MkdirAll(mirrorPath)
-	mod := GitModule{mirrorPath, nil}
-	if err := mod.clone(url, true); err != nil {
+	if err := os.MkdirAll(mirrorPath, moduleDirMode); err != nil {
+		return nil, err
+	}
+	mod := GitModule{path: mirrorPath, logger: logger}
+	if err := mod.clone(url, true, FullClone); err != nil {
 		return nil, err
 	}
-	log.Debug("Mirror cloned at '%s'.\n", mirrorPath)
+	logger.Debug("Mirror cloned at '%s'.\n", mirrorPath)
+	recordMirrorUpdate(mirrorPath, url, logger)
 
-	return &GitMirror{path: mirrorPath}, nil
+	return &GitMirror{path: mirrorPath, logger: logger}, nil
+}
+
+// Path returns the path of the bare mirror repository.
+func (m *GitMirror) Path() string {
+	return m.path
+}
+
+// Update fetches all new refs from the remote into the mirror.
+func (m *GitMirror) Update() error {
+	if config.GetConfig().Offline {
+		m.logger.Debug("Not updating mirror '%s' in offline mode.\n", m.path)
+		return nil
+	}
+	if m.readOnly {
+		// The mirror is updated in the writable layer instead, which only stores the new objects.
+		if created, err := m.makeWritable(); err != nil || created {
+			return err
+		}
+	}
+	url := m.url()
+	lock, err := lockMirror(m.path, url)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	return m.update(url)
+}
+
+// Refresh updates the mirror like Update, unless the mirror has been updated within the configured
+// mirror refresh interval. Modules that use the mirror as a reference then find new commits in it.
+func (m *GitMirror) Refresh() error {
+	configuration := config.GetConfig()
+	if configuration.Offline {
+		return nil
+	}
+	if m.readOnly {
+		m.logger.Debug("Not refreshing mirror '%s' in a read-only mirror layer.\n", m.path)
+		return nil
+	}
+	url := m.url()
+	lock, err := lockMirror(m.path, url)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	// Another process might have updated the mirror while we were waiting for the lock.
+	if usage, ok := readMirrorUsage(m.path); ok {
+		if age := time.Since(usage.LastUpdated); age < configuration.MirrorRefreshInterval() {
+			m.logger.Debug("Mirror '%s' has been updated %s ago. Not updating it.\n", m.path, age.Round(time.Second))
+			return nil
+		}
+	}
+	return m.update(url)
+}
+
+// update fetches all new refs from the remote into the mirror. The caller must hold the lock of the mirror.
+// Modules borrow the objects of the mirror, so refs that have been deleted upstream are kept, and commits
+// that have become unreachable (e.g., by a force-push) are never pruned by git gc.
+func (m *GitMirror) update(url string) error {
+	m.logger.Debug("Updating mirror '%s'.\n", m.path)
+	if _, stderr, err := m.repo().tryRunGitCommand("config", "gc.pruneExpire", "never"); err != nil {
+		return fmt.Errorf("failed to configure mirror '%s': %s", m.path, stderr)
+	}
+	_, stderr, err := m.repo().tryRunNetworkGitCommand("-c", "fetch.prune=false", "remote", "update")
+	if err != nil {
+		return fmt.Errorf("failed to update mirror '%s': %s", m.path, stderr)
+	}
+	recordMirrorUpdate(m.path, url, m.logger)
+	return nil
+}
+
+// makeWritable switches the mirror from its entry in a read-only mirror layer to its entry in the writable
+// mirror. If that entry does not exist yet, it is cloned using the read-only entry as a reference, so it only
+// stores objects that are missing in the read-only entry. Returns whether the entry has been created.
+func (m *GitMirror) makeWritable() (bool, error) {
+	url := m.url()
+	mirrorPath := mirrorEntryPath(gitMirrorPrefix, url)
+	lock, err := lockMirror(mirrorPath, url)
+	if err != nil {
+		return false, err
+	}
+	defer lock.Unlock()
+
+	created := false
+	if !util.DirExists(mirrorPath) {
+		m.logger.Debug("Cloning '%s' as mirror '%s' using read-only mirror '%s'.\n", url, mirrorPath, m.path)
+		if err := os.MkdirAll(mirrorPath, moduleDirMode); err != nil {
+			return false, err
+		}
+		_, stderr, err := GitModule{path: mirrorPath, logger: m.logger}.tryRunNetworkGitCommand("clone", "--mirror", "--reference", m.path, url, mirrorPath)
+		if err != nil {
+			os.RemoveAll(mirrorPath)
+			return false, fmt.Errorf("failed to clone mirror '%s': %s", mirrorPath, stderr)
+		}
+		recordMirrorUpdate(mirrorPath, url, m.logger)
+		created = true
+	}
+	m.path = mirrorPath
+	m.readOnly = false
+	return created, nil
+}
+
+// url returns the url the mirror has been cloned from.
+func (m *GitMirror) url() string {
+	url, _, _ := m.repo().tryRunGitCommand("config", "--get", "remote.origin.url")
+	return url
+}
+
+// RevParse returns the commit hash for the commit referenced by `rev`. Remote branches
+// (e.g., 'origin/master') are resolved to the corresponding branch of the mirror.
+func (m *GitMirror) RevParse(rev string) (string, error) {
+	stdout, stderr, err := m.repo().tryRunGitCommand("rev-list", "-n", "1", mirrorRef(rev))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve '%s' in mirror '%s': %s", rev, m.path, stderr)
+	}
+	return stdout, nil
+}
+
+// IsAncestor returns whether ancestor is an ancestor of rev in the commit tree.
+func (m *GitMirror) IsAncestor(ancestor, rev string) bool {
+	return m.repo().IsAncestor(ancestor, mirrorRef(rev))
+}
+
+// HasRevision returns whether the commit `hash` is present in the mirror.
+func (m *GitMirror) HasRevision(hash string) bool {
+	_, _, err := m.repo().tryRunGitCommand("cat-file", "-e", hash+"^{commit}")
+	return err == nil
+}
+
+// ReadModuleFile reads the MODULE file of the commit `hash`.
+func (m *GitMirror) ReadModuleFile(hash string) (ModuleFile, error) {
+	moduleFilePath := path.Join(m.subdir, util.ModuleFileName)
+	if _, _, err := m.repo().tryRunGitCommand("cat-file", "-e", hash+":"+moduleFilePath); err != nil {
+		m.logger.Debug("Module has no %s file at '%s'.\n", moduleFilePath, hash)
+		return emptyModuleFile(), nil
+	}
+	stdout, stderr, err := m.repo().tryRunGitCommand("show", hash+":"+moduleFilePath)
+	if err != nil {
+		return ModuleFile{}, fmt.Errorf("failed to read %s file at '%s': %s", util.ModuleFileName, hash, stderr)
+	}
+	return ParseModuleFile([]byte(stdout))
+}
+
+// Submodules returns the submodules of the commit `hash`, without nested submodules. For subdirectory
+// modules, only the submodules inside of the subdirectory are returned.
+func (m *GitMirror) Submodules(hash string) ([]Submodule, error) {
+	if _, _, err := m.repo().tryRunGitCommand("cat-file", "-e", hash+":.gitmodules"); err != nil {
+		return nil, nil
+	}
+	stdout, _, err := m.repo().tryRunGitCommand("config", "--blob", hash+":.gitmodules", "--get-regexp", `^submodule\..*\.(path|url)$`)
+	if err != nil {
+		// The .gitmodules file does not list any submodules.
+		return nil, nil
+	}
+	paths := map[string]string{}
+	urls := map[string]string{}
+	for _, line := range strings.Split(stdout, "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		if name, ok := strings.CutSuffix(strings.TrimPrefix(key, "submodule."), ".path"); ok {
+			paths[name] = value
+		} else if name, ok := strings.CutSuffix(strings.TrimPrefix(key, "submodule."), ".url"); ok {
+			urls[name] = value
+		}
+	}
+
+	baseURL, _, _ := m.repo().tryRunGitCommand("config", "--get", "remote.origin.url")
+	submodules := []Submodule{}
+	for _, name := range util.OrderedKeys(paths) {
+		submodulePath := paths[name]
+		if m.subdir != "" && submodulePath != m.subdir && !strings.HasPrefix(submodulePath, m.subdir+"/") {
+			continue
+		}
+		// Submodules are stored as gitlinks ("160000 commit <hash>\t<path>") in the tree of the commit.
+		stdout, stderr, err := m.repo().tryRunGitCommand("ls-tree", hash, "--", submodulePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read submodule '%s' at '%s': %s", submodulePath, hash, stderr)
+		}
+		fields := strings.Fields(stdout)
+		if len(fields) < 3 || fields[1] != "commit" {
+			m.logger.Debug("Submodule '%s' is not part of commit '%s'.\n", submodulePath, hash)
+			continue
+		}
+		if urls[name] == "" {
+			return nil, fmt.Errorf("submodule '%s' has no url", submodulePath)
+		}
+		submodules = append(submodules, Submodule{
+			Path: submodulePath,
+			URL:  resolveSubmoduleURL(baseURL, urls[name]),
+			Hash: fields[2],
+		})
+	}
+	return submodules, nil
+}
+
+// resolveSubmoduleURL resolves the submodule url `url`, which may be relative, against the url of
+// the superproject like 'git submodule init' does.
+func resolveSubmoduleURL(baseURL, url string) string {
+	if !strings.HasPrefix(url, "./") && !strings.HasPrefix(url, "../") {
+		return url
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	separator := "/"
+	for {
+		if rest, ok := util.CutPrefix(url, "./"); ok {
+			url = rest
+		} else if rest, ok := util.CutPrefix(url, "../"); ok {
+			url = rest
+			if idx := strings.LastIndexAny(baseURL, "/:"); idx >= 0 {
+				separator = baseURL[idx : idx+1]
+				baseURL = baseURL[:idx]
+			}
+		} else {
+			break
+		}
+	}
+	return baseURL + separator + url
+}
+
+func (m *GitMirror) repo() GitModule {
+	return GitModule{path: m.path, logger: m.logger}
+}
+
+// forSubdir returns a mirror that reads the MODULE file from the subdirectory `subdir` of the repository.
+func (m *GitMirror) forSubdir(subdir string) *GitMirror {
+	return &GitMirror{path: m.path, subdir: subdir, readOnly: m.readOnly, logger: m.logger}
+}
+
+// mirrorRef maps a ref of a regular clone to the equivalent ref in a mirror. Mirrors have no
+// remote tracking branches, the remote branches are the local branches of the mirror instead.
+func mirrorRef(rev string) string {
+	if branch, ok := util.CutPrefix(rev, "origin/"); ok {
+		return "refs/heads/" + branch
+	}
+	return rev
 }
 
 // createGitModule creates a new GitModule in the given `modulePath`
-// by cloning the repository from `url`.
-func CreateGitModule(modulePath, url string) (Module, error) {
+// by cloning the repository from `url` using the clone mode `mode`.
+// The module prints all messages to `logger`.
+func CreateGitModule(modulePath, url string, mode CloneMode, logger *log.Logger) (Module, error) {
 	// Figure out if there is a local mirror for it
-	mirror, err := getOrCreateGitMirror(url)
+	mirror, err := getOrCreateGitMirror(url, logger)
 	if err != nil {
 		return nil, err
 	}
+	if mirror != nil {
+		if err := mirror.Refresh(); err != nil {
+			logger.Warning("Failed to refresh mirror: %s.\n", err)
+		}
+	}
 
-	mod := GitModule{modulePath, mirror}
-	util.MkdirAll(modulePath)
-	if err := mod.clone(url, false); err != nil {
+	mod := GitModule{path: modulePath, mirror: mirror, logger: logger}
+	if err := os.MkdirAll(modulePath, moduleDirMode); err != nil {
+		return nil, err
+	}
+	if err := mod.clone(url, false, mode); err != nil {
 		return nil, err
 	}
 
 	return mod, nil
 }
 
+// openGitModule opens the git repository at `modulePath` together with its mirror (if it has a remote).
+// The module prints all messages to `logger`.
+func openGitModule(modulePath string, logger *log.Logger) GitModule {
+	module := GitModule{path: modulePath, logger: logger}
+	if url, _, err := module.tryRunGitCommand("config", "--get", "remote.origin.url"); err == nil {
+		module.mirror, _ = getOrCreateGitMirror(url, logger)
+	}
+	return module
+}
+
 func (m GitModule) Name() string {
+	if m.subdir != "" {
+		// Subdirectory modules are named after the dependency, which is the name of their checkout.
+		return path.Base(m.path)
+	}
 	return strings.TrimSuffix(path.Base(m.URL()), ".git")
 }
 
+// Subdir returns the subdirectory of the repository that contains the module (empty if the module
+// is the whole repository).
+func (m GitModule) Subdir() string {
+	return m.subdir
+}
+
+// RootPath returns the path of the module, which is the subdirectory of the repository for subdirectory modules.
 func (m GitModule) RootPath() string {
-	return m.path
+	return path.Join(m.path, m.subdir)
 }
 
 // URL returns the url of the underlying git repository.
@@ -99,37 +464,337 @@ func (m GitModule) RevParse(ref string) string {
 	return string(m.runGitCommand("rev-list", "-n", "1", ref))
 }
 
-// IsDirty returns whether the underlying repository has any uncommited changes.
+// IsDirty returns whether the underlying repository or any of its submodules has any uncommited changes.
+// Submodules that are not checked out at the commit recorded in the repository are brought up to date by
+// Checkout, so they only count as changes if they are checked out at a commit that is not on any remote
+// branch or tag (e.g., a local commit).
 func (m GitModule) IsDirty() bool {
-	return len(m.runGitCommand("status", "-s")) > 0
+	dirty, err := m.isDirty()
+	if err != nil {
+		log.Fatal("Failed to check module '%s' for local changes: %s.\n", m.path, err)
+	}
+	return dirty
+}
+
+func (m GitModule) isDirty() (bool, error) {
+	stdout, stderr, err := m.tryRunGitCommand("status", "-s", "--ignore-submodules=all")
+	if err != nil {
+		return false, fmt.Errorf("%s", stderr)
+	}
+	if len(stdout) > 0 {
+		return true, nil
+	}
+	stdout, stderr, err = m.tryRunGitCommand("submodule", "foreach", "--quiet", "--recursive", "git status -s --ignore-submodules=all")
+	if err != nil {
+		return false, fmt.Errorf("%s", stderr)
+	}
+	if len(stdout) > 0 {
+		return true, nil
+	}
+
+	// Submodules that are not checked out at the recorded commit are marked with '+' and those with
+	// merge conflicts with 'U'.
+	stdout, stderr, err = m.tryRunGitCommand("submodule", "status", "--recursive")
+	if err != nil {
+		return false, fmt.Errorf("%s", stderr)
+	}
+	for _, line := range strings.Split(stdout, "\n") {
+		if strings.HasPrefix(line, "U") {
+			return true, nil
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "+"))
+		if !strings.HasPrefix(line, "+") || len(fields) < 2 {
+			continue
+		}
+		// Commits that are not reachable from any remote branch or tag have been made or fetched by the user
+		// and would be lost when the submodule is checked out at the recorded commit.
+		submodule := GitModule{path: path.Join(m.path, fields[1]), logger: m.logger}
+		refs, _, err := submodule.tryRunGitCommand("for-each-ref", "--contains", fields[0], "refs/remotes", "refs/tags")
+		if err != nil || refs == "" {
+			m.logger.Debug("Submodule '%s' is checked out at commit '%s', which is not on any remote branch or tag.\n", fields[1], fields[0])
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Submodules returns all checked out submodules of the repository, including nested submodules.
+func (m GitModule) Submodules() ([]Submodule, error) {
+	stdout, stderr, err := m.tryRunGitCommand("submodule", "foreach", "--quiet", "--recursive",
+		`printf '%s\t%s\t%s\n' "$displaypath" "$(git rev-parse HEAD)" "$(git config --get remote.origin.url)"`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list submodules: %s", stderr)
+	}
+
+	submodules := []Submodule{}
+	for _, line := range strings.Split(stdout, "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		submodules = append(submodules, Submodule{Path: fields[0], Hash: fields[1], URL: fields[2]})
+	}
+	return submodules, nil
+}
+
+// updateSubmodules checks out all submodules at the commits recorded in the current commit of the
+// repository, cloning missing submodules using their mirrors as references (if available). Subdirectory
+// modules only update the submodules inside of their subdirectory.
+func (m GitModule) updateSubmodules() error {
+	if !util.FileExists(path.Join(m.path, ".gitmodules")) {
+		return nil
+	}
+
+	// Submodule URLs might have changed since the submodules have been cloned.
+	if _, stderr, err := m.tryRunGitCommand("submodule", "sync", "--quiet"); err != nil {
+		return fmt.Errorf("failed to sync submodule urls: %s", stderr)
+	}
+	stdout, _, err := m.tryRunGitCommand("config", "--file", ".gitmodules", "--get-regexp", `^submodule\..*\.path$`)
+	if err != nil {
+		// The .gitmodules file does not list any submodules.
+		return nil
+	}
+
+	for _, line := range strings.Split(stdout, "\n") {
+		key, submodulePath, _ := strings.Cut(line, " ")
+		name := strings.TrimSuffix(strings.TrimPrefix(key, "submodule."), ".path")
+		if m.subdir != "" && submodulePath != m.subdir && !strings.HasPrefix(submodulePath, m.subdir+"/") {
+			continue
+		}
+		if err := m.updateSubmodule(name, submodulePath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m GitModule) updateSubmodule(name, submodulePath string) error {
+	if _, stderr, err := m.tryRunGitCommand("submodule", "init", "--", submodulePath); err != nil {
+		return fmt.Errorf("failed to initialize submodule '%s': %s", submodulePath, stderr)
+	}
+	// Relative submodule urls have been resolved by 'git submodule init'.
+	url, _, err := m.tryRunGitCommand("config", "--get", "submodule."+name+".url")
+	if err != nil {
+		return fmt.Errorf("submodule '%s' has no url", submodulePath)
+	}
+	mirror, err := getOrCreateGitMirror(url, m.logger)
+	if err != nil {
+		return err
+	}
+
+	submodule := GitModule{path: path.Join(m.path, submodulePath), mirror: mirror, logger: m.logger}
+	cloned := util.DirExists(path.Join(submodule.path, ".git")) || util.FileExists(path.Join(submodule.path, ".git"))
+
+	args := []string{"submodule", "update"}
+	if mirror != nil {
+		args = append(args, "--reference", mirror.path)
+	}
+	if m.isShallow() {
+		args = append(args, "--depth", "1")
+	}
+	if config.GetConfig().Offline {
+		if mirror == nil && !cloned {
+			return fmt.Errorf("submodule '%s' ('%s') is not available in the mirror in offline mode", submodulePath, url)
+		}
+		if mirror != nil {
+			// Submodules are cloned and fetched from the mirror instead of their url.
+			args = append([]string{"-c", "submodule." + name + ".url=" + mirror.path}, args...)
+			if cloned {
+				if _, err := submodule.Fetch(); err != nil {
+					return fmt.Errorf("failed to update submodule '%s': %s", submodulePath, err)
+				}
+			}
+		}
+		args = append(args, "--no-fetch")
+	}
+
+	m.logger.Debug("Updating submodule '%s'.\n", submodulePath)
+	if _, stderr, err := m.tryRunNetworkGitCommand(append(args, "--", submodulePath)...); err != nil {
+		return fmt.Errorf("failed to update submodule '%s': %s", submodulePath, stderr)
+	}
+	if config.GetConfig().Offline && mirror != nil && !cloned {
+		if _, stderr, err := submodule.tryRunGitCommand("remote", "set-url", "origin", url); err != nil {
+			return fmt.Errorf("failed to set url of submodule '%s': %s", submodulePath, stderr)
+		}
+	}
+	return submodule.updateSubmodules()
 }
 
 // IsAncestor returns whether ancestor is an ancestor of rev in the commit tree.
+// Shallow clones do not contain the complete history, so the mirror, which does, is asked instead if it
+// contains both commits. Otherwise, the history of the clone is deepened by at most the sum of `deepenSteps`.
+// If the ancestor is not found, whether it is an ancestor is unknown and false is returned.
 func (m GitModule) IsAncestor(ancestor, rev string) bool {
+	if m.isAncestor(ancestor, rev) {
+		return true
+	}
+	if !m.isShallow() {
+		return false
+	}
+
+	if m.mirror != nil && m.mirror.HasRevision(ancestor) {
+		// Branches are resolved in the clone, since the mirror stores them under different names.
+		revHash, _, err := m.tryRunGitCommand("rev-parse", rev+"^{commit}")
+		if err != nil {
+			revHash = rev
+		}
+		if m.mirror.HasRevision(revHash) {
+			m.logger.Debug("Looking for ancestor '%s' of '%s' in mirror '%s'.\n", ancestor, rev, m.mirror.path)
+			return m.mirror.repo().isAncestor(ancestor, revHash)
+		}
+	}
+
+	remote := m.fetchRemote()
+	if remote == "" {
+		m.logger.Debug("Not deepening the history of '%s' in offline mode.\n", m.path)
+		return false
+	}
+	if !m.HasRevision(ancestor) {
+		if err := m.fetchRevision(ancestor); err != nil {
+			m.logger.Debug("%s.\n", err)
+			return false
+		}
+		if m.isAncestor(ancestor, rev) {
+			return true
+		}
+	}
+	for _, depth := range deepenSteps {
+		m.logger.Debug("Deepening the history of '%s' by %d commits.\n", m.path, depth)
+		if _, stderr, err := m.tryRunNetworkGitCommand("fetch", fmt.Sprintf("--deepen=%d", depth), remote); err != nil {
+			m.logger.Debug("Failed to deepen the history of '%s': %s.\n", m.path, stderr)
+			return false
+		}
+		if m.isAncestor(ancestor, rev) {
+			return true
+		}
+		if !m.isShallow() {
+			return false
+		}
+	}
+	m.logger.Debug("Commit '%s' has not been found in the shallow history of '%s'. Not fetching the complete history.\n", ancestor, m.path)
+	return false
+}
+
+func (m GitModule) isAncestor(ancestor, rev string) bool {
 	_, _, err := m.tryRunGitCommand("merge-base", "--is-ancestor", ancestor, rev)
 	return err == nil
 }
 
+func (m GitModule) isShallow() bool {
+	stdout, _, err := m.tryRunGitCommand("rev-parse", "--is-shallow-repository")
+	return err == nil && stdout == "true"
+}
+
+// CloneMode returns the clone mode the repository has been cloned with. Shallow clones whose
+// complete history has been fetched since are full clones.
+func (m GitModule) CloneMode() CloneMode {
+	if m.isShallow() {
+		return ShallowClone
+	}
+	if filter, _, err := m.tryRunGitCommand("config", "--get", "remote.origin.partialclonefilter"); err == nil && filter != "" {
+		return BloblessClone
+	}
+	return FullClone
+}
+
+// fetchRemote returns the remote that missing commits are fetched from. In offline mode, commits
+// are fetched from the mirror. It returns an empty string if there is no such remote.
+func (m GitModule) fetchRemote() string {
+	if !config.GetConfig().Offline {
+		return "origin"
+	}
+	if m.mirror == nil {
+		return ""
+	}
+	return m.mirror.path
+}
+
+// fetchRevision fetches the commit `hash`, which is not reachable from any branch or tag that has been
+// fetched so far (e.g., because the history of a shallow clone is truncated). Shallow clones only fetch
+// the commit itself, not its history.
+func (m GitModule) fetchRevision(hash string) error {
+	remote := m.fetchRemote()
+	if remote == "" {
+		return fmt.Errorf("commit '%s' is not available in offline mode", hash)
+	}
+	m.logger.Debug("Fetching commit '%s' from '%s'.\n", hash, remote)
+	if _, stderr, err := m.tryRunNetworkGitCommand(m.fetchCommand(remote, hash)...); err != nil {
+		return fmt.Errorf("failed to fetch commit '%s': %s", hash, stderr)
+	}
+	return nil
+}
+
+// HasRevision returns whether the commit `hash` is available in the repository (or its mirror).
+func (m GitModule) HasRevision(hash string) bool {
+	_, _, err := m.tryRunGitCommand("cat-file", "-e", hash+"^{commit}")
+	return err == nil
+}
+
+// fetchCommand returns the arguments of a git fetch command with the arguments `args`. Shallow clones
+// only fetch the tips of branches and tags, not their history, which is fetched on demand.
+func (m GitModule) fetchCommand(args ...string) []string {
+	command := []string{"fetch"}
+	if m.isShallow() {
+		command = append(command, "--depth", "1")
+	}
+	return append(command, args...)
+}
+
 // Fetch fetches changes from the default remote and reports whether any updates have been fetched.
-func (m GitModule) Fetch() bool {
-	if m.IsDirty() {
+// In offline mode, changes are only fetched from the mirror.
+func (m GitModule) Fetch() (bool, error) {
+	if dirty, err := m.isDirty(); err != nil {
+		return false, fmt.Errorf("failed to check for local changes: %s", err)
+	} else if dirty {
 		// If the module has uncommited changes, it does not match any version.
-		log.Warning("The module has uncommited changes. Not fetching any changes.\n")
-		return false
+		m.logger.Warning("The module has uncommited changes. Not fetching any changes.\n")
+		return false, nil
+	}
+
+	if config.GetConfig().Offline {
+		if m.mirror == nil {
+			m.logger.Debug("Not fetching any changes in offline mode.\n")
+			return false, nil
+		}
+		m.logger.Debug("Fetching changes from mirror '%s' in offline mode.\n", m.mirror.path)
+		stdout, stderr, err := m.tryRunNetworkGitCommand(m.fetchCommand("--tags", m.mirror.path, "+refs/heads/*:refs/remotes/origin/*")...)
+		if err != nil {
+			return false, fmt.Errorf("failed to fetch changes from mirror '%s': %s", m.mirror.path, stderr)
+		}
+		return len(stdout) > 0, nil
 	}
 
-	return len(m.runGitCommand("fetch", "--all", "--tags")) > 0
+	// Update the mirror first, so that it stays useful as a reference for new clones.
+	if m.mirror != nil {
+		if err := m.mirror.Refresh(); err != nil {
+			m.logger.Warning("Failed to refresh mirror: %s.\n", err)
+		}
+	}
+	stdout, stderr, err := m.tryRunNetworkGitCommand(m.fetchCommand("--all", "--tags")...)
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch changes: %s", stderr)
+	}
+	return len(stdout) > 0, nil
 }
 
 // Checkout changes the current module's version to `ref`.
 func (m GitModule) Checkout(ref string) {
 	if m.IsDirty() {
 		// If the module has uncommited changes, it does not match any version.
-		log.Debug("The module has uncommited changes.\n")
+		m.logger.Debug("The module has uncommited changes.\n")
 		return
 	}
 
+	// Shallow and blobless clones might not have fetched the commit yet.
+	if !m.HasRevision(ref) && m.CloneMode() != FullClone {
+		if err := m.fetchRevision(ref); err != nil {
+			m.logger.Debug("%s.\n", err)
+		}
+	}
 	m.runGitCommand("checkout", ref)
+	if err := m.updateSubmodules(); err != nil {
+		log.Fatal("Failed to update the submodules of module '%s': %s.\n", m.Name(), err)
+	}
 }
 
 func (m GitModule) Type() ModuleType {
@@ -179,10 +844,59 @@ func (m GitModule) runGitCommand(args ...string) string {
 // Tries to run a git subcommand and return stdout, stderr and an error if the process exited with
 // an exit code != 0
 func (m GitModule) tryRunGitCommand(args ...string) (string, string, error) {
+	return m.tryRunGitCommandContext(context.Background(), args...)
+}
+
+// Runs a git command that accesses the network (or the mirror), exiting with an error message if the
+// command still fails after all retries.
+func (m GitModule) runNetworkGitCommand(args ...string) string {
+	stdout, stderr, err := m.tryRunNetworkGitCommand(args...)
+	if err != nil {
+		log.Fatal("Failed to run git command 'git %s':\n%s\n%s\n", strings.Join(args, " "), stderr, stdout)
+	}
+	return stdout
+}
+
+// Tries to run a git subcommand that accesses the network (or the mirror), retrying it if it fails.
+// If it still fails after all retries, the returned stderr describes the failure of the last attempt
+// (including whether it timed out).
+func (m GitModule) tryRunNetworkGitCommand(args ...string) (string, string, error) {
+	var stdout, stderr string
+	var err error
+	retryErr := retryNetworkOperation(m.logger, fmt.Sprintf("Running 'git %s' in '%s'", strings.Join(args, " "), m.path), func(ctx context.Context) error {
+		stdout, stderr, err = m.tryRunGitCommandContext(ctx, args...)
+		if err == nil || stderr == "" {
+			return err
+		}
+		if isPermanentGitError(stderr) {
+			return permanentError{fmt.Errorf("%s", stderr)}
+		}
+		return fmt.Errorf("%s", stderr)
+	})
+	if retryErr != nil {
+		stderr = retryErr.Error()
+	}
+	return stdout, stderr, err
+}
+
+// isPermanentGitError returns whether the git error `stderr` is not resolved by running the command again.
+func isPermanentGitError(stderr string) bool {
+	for _, message := range permanentGitErrors {
+		if message.MatchString(stderr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m GitModule) tryRunGitCommandContext(ctx context.Context, args ...string) (string, string, error) {
 	stderr := bytes.Buffer{}
 	stdout := bytes.Buffer{}
-	log.Debug("Running git command: git %s\n", strings.Join(args, " "))
-	cmd := exec.Command("git", args...)
+	m.logger.Debug("Running git command: git %s\n", strings.Join(args, " "))
+	cmd := exec.CommandContext(ctx, "git", args...)
+	// Child processes of git (e.g., remote helpers) might keep the output pipes open after git has been killed.
+	cmd.WaitDelay = time.Second
+	cmd.Env = gitEnvironment()
 	cmd.Stderr = &stderr
 	cmd.Stdout = &stdout
 	cmd.Dir = m.path
@@ -190,24 +904,83 @@ func (m GitModule) tryRunGitCommand(args ...string) (string, string, error) {
 	return strings.TrimSuffix(stdout.String(), "\n"), strings.TrimSuffix(stderr.String(), "\n"), err
 }
 
+// gitEnvironment returns the environment for running git commands. It turns the url rewrites from the
+// configuration into 'insteadOf' rules, so they apply to all git commands and their child processes (e.g., when
+// cloning submodules or fetching missing objects of blobless clones), while the remotes of all repositories
+// keep their original urls. It returns nil (the environment of dbt) if there are no url rewrites.
+func gitEnvironment() []string {
+	rewrites := config.GetConfig().UrlRewrites
+	if len(rewrites) == 0 {
+		return nil
+	}
+
+	// Keep configuration that has been passed to dbt in the same way.
+	env := os.Environ()
+	count := 0
+	if value, ok := os.LookupEnv("GIT_CONFIG_COUNT"); ok {
+		count, _ = strconv.Atoi(value)
+	}
+	for _, prefix := range util.OrderedKeys(rewrites) {
+		env = append(env,
+			fmt.Sprintf("GIT_CONFIG_KEY_%d=url.%s.insteadOf", count, rewrites[prefix]),
+			fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", count, prefix))
+		count++
+	}
+	return append(env, fmt.Sprintf("GIT_CONFIG_COUNT=%d", count))
+}
+
 // Clones a module from the given url at the specfied path location. If asMirror is passed, then a
 // mirror is created instead of a regular git repository.
 // If the git module has a mirror assigned, it will be used as the reference for the new git repository.
-func (m GitModule) clone(url string, asMirror bool) error {
+// Subdirectory modules only check out their subdirectory (using a sparse checkout).
+// Submodules are cloned after the repository, so that they can use their own mirrors as references.
+// The clone mode `mode` only applies to clones from `url`. Mirrors are always full clones, and clones
+// from the mirror in offline mode share all objects with the mirror anyway.
+func (m GitModule) clone(url string, asMirror bool, mode CloneMode) error {
+	checkoutFlag := "--checkout"
+	if m.subdir != "" {
+		checkoutFlag = "--no-checkout"
+	}
+
+	var stderr string
 	var err error
 	if asMirror {
-		log.Debug("Cloning '%s' as mirror '%s'.\n", url, m.path)
-		_, _, err = m.tryRunGitCommand("clone", "--mirror", url, m.path)
+		m.logger.Debug("Cloning '%s' as mirror '%s'.\n", url, m.path)
+		_, stderr, err = m.tryRunNetworkGitCommand("clone", "--mirror", url, m.path)
+	} else if config.GetConfig().Offline {
+		if m.mirror == nil {
+			return fmt.Errorf("'%s' is not available in the mirror in offline mode", url)
+		}
+		m.logger.Log("Cloning '%s' from mirror '%s'.\n", url, m.mirror.path)
+		_, stderr, err = m.tryRunNetworkGitCommand("clone", checkoutFlag, "--reference", m.mirror.path, m.mirror.path, m.path)
+		if err == nil {
+			_, stderr, err = m.tryRunGitCommand("remote", "set-url", "origin", url)
+		}
 	} else if m.mirror != nil {
-		log.Log("Cloning '%s' using mirror '%s'.\n", url, m.mirror.path)
-		_, _, err = m.tryRunGitCommand("clone", "--recursive", "--reference", m.mirror.path, url, m.path)
+		m.logger.Log("Cloning '%s' using mirror '%s'.\n", url, m.mirror.path)
+		args := append([]string{"clone", checkoutFlag, "--reference", m.mirror.path}, mode.cloneFlags()...)
+		_, stderr, err = m.tryRunNetworkGitCommand(append(args, url, m.path)...)
 	} else {
-		log.Log("Cloning '%s'.\n", url)
-		_, _, err = m.tryRunGitCommand("clone", "--recursive", url, m.path)
+		m.logger.Log("Cloning '%s'.\n", url)
+		args := append([]string{"clone", checkoutFlag}, mode.cloneFlags()...)
+		_, stderr, err = m.tryRunNetworkGitCommand(append(args, url, m.path)...)
+	}
+	if err == nil && m.subdir != "" {
+		m.logger.Debug("Checking out subdirectory '%s'.\n", m.subdir)
+		if _, stderr, err = m.tryRunGitCommand("sparse-checkout", "set", "--cone", m.subdir); err == nil {
+			_, stderr, err = m.tryRunGitCommand("checkout")
+		}
 	}
 	if err != nil {
 		// Leave clean state so that the operation can be retried
-		util.RemoveDir(m.path)
+		os.RemoveAll(m.path)
+		return fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr))
+	}
+	if !asMirror {
+		if err := m.updateSubmodules(); err != nil {
+			os.RemoveAll(m.path)
+			return err
+		}
 	}
-	return err
+	return nil
 }
@@ -0,0 +1,60 @@
+package module
+
+import "testing"
+
+func TestIsPermanentGitError(t *testing.T) {
+	tests := []struct {
+		stderr    string
+		permanent bool
+	}{
+		{"fatal: repository 'https://example.com/missing.git/' not found", true},
+		{"fatal: repository '/tmp/missing.git' does not exist", true},
+		{"fatal: '/tmp/missing' does not appear to be a git repository\nfatal: Could not read from remote repository.", true},
+		{"fatal: Authentication failed for 'https://example.com/repo.git/'", true},
+		{"fatal: could not read Username for 'https://example.com': terminal prompts disabled", true},
+		{"git@example.com: Permission denied (publickey).\nfatal: Could not read from remote repository.", true},
+		{"fatal: couldn't find remote ref refs/heads/missing", true},
+		{"fatal: remote error: upload-pack: not our ref 0123456789012345678901234567890123456789", true},
+		{"fatal: git upload-pack: not our ref 0123456789012345678901234567890123456789", true},
+		{"error: Server does not allow request for unadvertised object 0123456789012345678901234567890123456789", true},
+		{"fatal: unable to access 'https://example.com/repo.git/': Received HTTP code 404 from proxy after CONNECT", false},
+		{"fatal: unable to access 'https://example.com/repo.git/': Could not resolve host: example.com", false},
+		{"fatal: unable to access 'https://example.com/repo.git/': The requested URL returned error: 502", false},
+		{"error: RPC failed; curl 56 GnuTLS recv error (-9): Error decoding the received TLS packet.", false},
+		{"ssh: connect to host example.com port 22: Connection refused", false},
+		{"remote: Not found. Try again later.", false},
+	}
+
+	for _, test := range tests {
+		if permanent := isPermanentGitError(test.stderr); permanent != test.permanent {
+			t.Errorf("expected '%s' to be permanent: %v, got %v", test.stderr, test.permanent, permanent)
+		}
+	}
+}
+
+func TestResolveSubmoduleURL(t *testing.T) {
+	tests := []struct {
+		baseURL  string
+		url      string
+		expected string
+	}{
+		{"https://example.com/group/repo.git", "https://example.com/other/sub.git", "https://example.com/other/sub.git"},
+		{"https://example.com/group/repo.git", "git@example.com:other/sub.git", "git@example.com:other/sub.git"},
+		{"https://example.com/group/repo.git", "../sub.git", "https://example.com/group/sub.git"},
+		{"https://example.com/group/repo.git/", "../sub.git", "https://example.com/group/sub.git"},
+		{"https://example.com/group/repo.git", "../../other/sub.git", "https://example.com/other/sub.git"},
+		{"https://example.com/group/repo.git", "./sub.git", "https://example.com/group/repo.git/sub.git"},
+		{"https://example.com/group/repo.git", "./../sub.git", "https://example.com/group/sub.git"},
+		{"git@example.com:group/repo.git", "../sub.git", "git@example.com:group/sub.git"},
+		{"git@example.com:group/repo.git", "../../other/sub.git", "git@example.com:other/sub.git"},
+		{"git@example.com:repo.git", "../sub.git", "git@example.com:sub.git"},
+		{"/srv/git/repo.git", "../sub.git", "/srv/git/sub.git"},
+		{"/srv/git/repo.git", "./sub", "/srv/git/repo.git/sub"},
+	}
+
+	for _, test := range tests {
+		if resolved := resolveSubmoduleURL(test.baseURL, test.url); resolved != test.expected {
+			t.Errorf("expected '%s' relative to '%s' to resolve to '%s', got '%s'", test.url, test.baseURL, test.expected, resolved)
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package module
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"github.com/daedaleanai/dbt/v3/log"
+	"github.com/daedaleanai/dbt/v3/util"
+)
+
+const localMetadataFileName = ".local-metadata"
+
+const localUrlPrefix = "file://"
+
+// Hashes of local directories by path. Hashing a large directory is expensive, so every directory is
+// hashed at most once per invocation of dbt.
+var treeHashes = map[string]string{}
+var treeHashesMutex sync.Mutex
+
+type localMetadataFile struct {
+	URL  string
+	Hash string
+}
+
+// LocalModule is a module that is copied from a directory on the local machine (e.g., a test fixture
+// or the output of another build system). Its version is a hash computed over the content of the directory.
+// LocalModules only have a single version, which is the current content of the directory.
+type LocalModule struct {
+	path string
+	// Logger for the messages of the module (nil prints them right away).
+	logger *log.Logger
+}
+
+// LocalMirror gives access to the source directory of a LocalModule. The directory is used as is,
+// so nothing is stored in the global mirror directory.
+type LocalMirror struct {
+	path string
+}
+
+// localSourcePath returns the directory referenced by `url`, which is either an absolute path or a
+// file:// URL.
+func localSourcePath(url string) (string, error) {
+	sourcePath, _ := util.CutPrefix(url, localUrlPrefix)
+	if !path.IsAbs(sourcePath) {
+		return "", fmt.Errorf("'%s' is not an absolute path", sourcePath)
+	}
+	if !util.DirExists(sourcePath) {
+		return "", fmt.Errorf("directory '%s' does not exist", sourcePath)
+	}
+	return sourcePath, nil
+}
+
+func getLocalMirror(url string) (*LocalMirror, error) {
+	sourcePath, err := localSourcePath(url)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalMirror{path: sourcePath}, nil
+}
+
+// Path returns the path of the source directory.
+func (m *LocalMirror) Path() string {
+	return m.path
+}
+
+// Update does nothing on LocalMirrors. The source directory is always up to date.
+func (m *LocalMirror) Update() error {
+	return nil
+}
+
+// RevParse returns the hash of the current content of the source directory.
+func (m *LocalMirror) RevParse(rev string) (string, error) {
+	return cachedHashTree(m.path)
+}
+
+func (m *LocalMirror) IsAncestor(ancestor, rev string) bool {
+	return true
+}
+
+// HasRevision returns whether the source directory currently has the hash `hash`.
+func (m *LocalMirror) HasRevision(hash string) bool {
+	current, err := m.RevParse("")
+	return err == nil && current == hash
+}
+
+// ReadModuleFile reads the MODULE file of the source directory.
+func (m *LocalMirror) ReadModuleFile(hash string) (ModuleFile, error) {
+	if !m.HasRevision(hash) {
+		return ModuleFile{}, fmt.Errorf("directory '%s' does not have hash '%s'", m.path, hash)
+	}
+	return ReadModuleFile(m.path), nil
+}
+
+// createLocalModule creates a new LocalModule in `modulePath` by copying the directory referenced
+// by `url`. If `expectedHash` is not empty, the directory must have that hash.
+// The module prints all messages to `logger`.
+func createLocalModule(modulePath, url, expectedHash string, logger *log.Logger) (Module, error) {
+	sourcePath, err := localSourcePath(url)
+	if err != nil {
+		return nil, err
+	}
+
+	module := LocalModule{path: modulePath, logger: logger}
+	if err := module.copy(url, sourcePath, expectedHash); err != nil {
+		return nil, err
+	}
+	return module, nil
+}
+
+// copy replaces the content of the module directory by the content of `sourcePath`, which must have
+// the hash `expectedHash` (unless it is empty).
+func (m LocalModule) copy(url, sourcePath, expectedHash string) error {
+	hash, err := cachedHashTree(sourcePath)
+	if err != nil {
+		return fmt.Errorf("failed to hash directory '%s': %s", sourcePath, err)
+	}
+	if expectedHash != "" && hash != expectedHash {
+		return fmt.Errorf("directory '%s' has hash '%s', but hash '%s' was expected", sourcePath, hash, expectedHash)
+	}
+
+	m.logger.Log("Copying '%s'.\n", sourcePath)
+	if err := os.RemoveAll(m.path); err != nil {
+		return err
+	}
+	if err := copyTree(sourcePath, m.path); err != nil {
+		return fmt.Errorf("failed to copy directory '%s': %s", sourcePath, err)
+	}
+	setCachedTreeHash(m.path, hash)
+	return writeMetadataFile(path.Join(m.path, localMetadataFileName), localMetadataFile{URL: url, Hash: hash})
+}
+
+func (m LocalModule) metadata() localMetadataFile {
+	var metadata localMetadataFile
+	util.ReadYaml(path.Join(m.path, localMetadataFileName), &metadata)
+	return metadata
+}
+
+func (m LocalModule) Name() string {
+	return path.Base(m.RootPath())
+}
+
+func (m LocalModule) RootPath() string {
+	return m.path
+}
+
+// URL returns the url of the source directory.
+func (m LocalModule) URL() string {
+	return m.metadata().URL
+}
+
+// Head returns the hash of the source directory at the time it was copied.
+func (m LocalModule) Head() string {
+	return m.metadata().Hash
+}
+
+// RevParse returns the hash of the current content of the source directory.
+func (m LocalModule) RevParse(rev string) string {
+	hash, err := m.mirror().RevParse(rev)
+	if err != nil {
+		log.Fatal("Failed to hash the source directory of module '%s': %s.\n", m.Name(), err)
+	}
+	return hash
+}
+
+// IsDirty returns whether the content of the module directory has changed since it was copied.
+func (m LocalModule) IsDirty() bool {
+	dirty, err := m.isDirty()
+	if err != nil {
+		log.Fatal("Failed to hash module '%s': %s.\n", m.Name(), err)
+	}
+	return dirty
+}
+
+func (m LocalModule) isDirty() (bool, error) {
+	hash, err := cachedHashTree(m.path)
+	if err != nil {
+		return false, err
+	}
+	var metadata localMetadataFile
+	if err := readMetadataFile(path.Join(m.path, localMetadataFileName), &metadata); err != nil {
+		return false, err
+	}
+	return hash != metadata.Hash, nil
+}
+
+func (m LocalModule) IsAncestor(ancestor, rev string) bool {
+	return true
+}
+
+// HasRevision returns whether the module or its source directory has the hash `hash`.
+func (m LocalModule) HasRevision(hash string) bool {
+	return m.Head() == hash || m.mirror().HasRevision(hash)
+}
+
+// Fetch reports whether the content of the source directory has changed since it was copied.
+func (m LocalModule) Fetch() (bool, error) {
+	hash, err := m.mirror().RevParse("")
+	if err != nil {
+		return false, fmt.Errorf("failed to hash the source directory: %s", err)
+	}
+	return hash != m.Head(), nil
+}
+
+// Checkout copies the source directory again if it has the hash `hash`. Other versions
+// are not available and result in an error.
+func (m LocalModule) Checkout(hash string) {
+	if hash == m.Head() {
+		return
+	}
+	mirror := m.mirror()
+	if err := m.copy(m.URL(), mirror.path, hash); err != nil {
+		log.Fatal("Failed to checkout version '%s': %s.\n", hash, err)
+	}
+}
+
+func (m LocalModule) Type() ModuleType {
+	return LocalModuleType
+}
+
+func (m LocalModule) mirror() *LocalMirror {
+	sourcePath, _ := util.CutPrefix(m.URL(), localUrlPrefix)
+	return &LocalMirror{path: sourcePath}
+}
+
+// skipLocalEntry reports whether the entry `relPath` of a local module directory is neither hashed
+// nor copied. Version control metadata is not part of the content of a module.
+func skipLocalEntry(relPath string) bool {
+	return relPath == localMetadataFileName || path.Base(relPath) == ".git"
+}
+
+// cachedHashTree returns the hash of the directory `root`, which is only computed the first time.
+func cachedHashTree(root string) (string, error) {
+	treeHashesMutex.Lock()
+	hash, found := treeHashes[root]
+	treeHashesMutex.Unlock()
+	if found {
+		return hash, nil
+	}
+
+	hash, err := hashTree(root)
+	if err != nil {
+		return "", err
+	}
+	setCachedTreeHash(root, hash)
+	return hash, nil
+}
+
+func setCachedTreeHash(root, hash string) {
+	treeHashesMutex.Lock()
+	defer treeHashesMutex.Unlock()
+	treeHashes[root] = hash
+}
+
+// hashTree computes a hash over the names, modes and contents of all files, directories and symlinks
+// inside the directory `root`.
+func hashTree(root string) (string, error) {
+	hasher := sha256.New()
+	err := filepath.WalkDir(root, func(entryPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(root, entryPath)
+		if err != nil || relPath == "." {
+			return err
+		}
+		if skipLocalEntry(relPath) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(entryPath)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(hasher, "symlink %q %q\n", relPath, target)
+		case info.IsDir():
+			// Copies of directories are always writable by their owner, so the owner-write bit is ignored.
+			fmt.Fprintf(hasher, "dir %q %o\n", relPath, info.Mode().Perm()|ownerWritable)
+		case info.Mode().IsRegular():
+			fileHash, err := hashFile(entryPath)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(hasher, "file %q %o %s\n", relPath, info.Mode().Perm(), fileHash)
+		default:
+			return fmt.Errorf("'%s' is not a regular file, directory or symlink", entryPath)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// ownerWritable is the owner-write permission bit.
+const ownerWritable os.FileMode = 0200
+
+// copyTree copies all files, directories and symlinks inside the directory `sourceDir` to `destDir`.
+// Directories stay writable by their owner, so that the copy can be removed again.
+func copyTree(sourceDir, destDir string) error {
+	return filepath.WalkDir(sourceDir, func(entryPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(sourceDir, entryPath)
+		if err != nil {
+			return err
+		}
+		if skipLocalEntry(relPath) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		destPath := path.Join(destDir, relPath)
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(entryPath)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(target, destPath)
+		case info.IsDir():
+			if err := os.MkdirAll(destPath, defaultDirMode); err != nil {
+				return err
+			}
+			return os.Chmod(destPath, info.Mode().Perm()|ownerWritable)
+		case info.Mode().IsRegular():
+			return copyFile(entryPath, destPath, info.Mode().Perm())
+		}
+		return fmt.Errorf("'%s' is not a regular file, directory or symlink", entryPath)
+	})
+}
+
+func copyFile(sourcePath, destPath string, mode os.FileMode) error {
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	dest, err := os.OpenFile(destPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dest, source); err != nil {
+		dest.Close()
+		return err
+	}
+	if err := dest.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(destPath, mode)
+}
@@ -0,0 +1,142 @@
+package module
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+// makeTestTree creates a directory with a file, an executable, a subdirectory, a symlink and a .git directory.
+func makeTestTree(t *testing.T) string {
+	root := path.Join(t.TempDir(), "tree")
+	for _, dir := range []string{root, path.Join(root, "sub"), path.Join(root, ".git")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := []struct {
+		name    string
+		content string
+		mode    os.FileMode
+	}{
+		{"file", "content", 0644},
+		{"sub/script", "#!/bin/sh", 0755},
+		{".git/HEAD", "ref: refs/heads/master", 0644},
+	}
+	for _, file := range files {
+		if err := os.WriteFile(path.Join(root, file.name), []byte(file.content), file.mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("sub/script", path.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestHashTree(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(root string) error
+		changed bool
+	}{
+		{"unchanged", func(root string) error { return nil }, false},
+		{"file content", func(root string) error { return os.WriteFile(path.Join(root, "file"), []byte("other"), 0644) }, true},
+		{"file mode", func(root string) error { return os.Chmod(path.Join(root, "file"), 0600) }, true},
+		{"directory mode", func(root string) error { return os.Chmod(path.Join(root, "sub"), 0700) }, true},
+		{"new file", func(root string) error { return os.WriteFile(path.Join(root, "new"), nil, 0644) }, true},
+		{"renamed file", func(root string) error { return os.Rename(path.Join(root, "file"), path.Join(root, "renamed")) }, true},
+		{"symlink target", func(root string) error {
+			if err := os.Remove(path.Join(root, "link")); err != nil {
+				return err
+			}
+			return os.Symlink("file", path.Join(root, "link"))
+		}, true},
+		{"symlink replaced by file", func(root string) error {
+			if err := os.Remove(path.Join(root, "link")); err != nil {
+				return err
+			}
+			return os.WriteFile(path.Join(root, "link"), []byte("sub/script"), 0644)
+		}, true},
+		{".git content", func(root string) error { return os.WriteFile(path.Join(root, ".git", "HEAD"), []byte("other"), 0644) }, false},
+		{"nested .git", func(root string) error { return os.MkdirAll(path.Join(root, "sub", ".git"), 0755) }, false},
+		{"metadata", func(root string) error {
+			return os.WriteFile(path.Join(root, localMetadataFileName), []byte("hash: x"), 0644)
+		}, false},
+	}
+
+	for _, test := range tests {
+		root := makeTestTree(t)
+		before, err := hashTree(root)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if err := test.change(root); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		after, err := hashTree(root)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if (before != after) != test.changed {
+			t.Errorf("%s: expected the hash to change: %v, got '%s' and '%s'", test.name, test.changed, before, after)
+		}
+	}
+}
+
+func TestCopyTree(t *testing.T) {
+	source := makeTestTree(t)
+	if err := os.Chmod(path.Join(source, "sub"), 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(path.Join(source, "sub"), 0755)
+
+	dest := path.Join(t.TempDir(), "copy")
+	if err := copyTree(source, dest); err != nil {
+		t.Fatal(err)
+	}
+
+	// Read-only directories stay writable by their owner, so that the copy can be removed.
+	modes := map[string]os.FileMode{"file": 0644, "sub/script": 0755, "sub": os.ModeDir | 0755}
+	for name, mode := range modes {
+		info, err := os.Lstat(path.Join(dest, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode() != mode {
+			t.Errorf("expected '%s' to have mode %s, got %s", name, mode, info.Mode())
+		}
+	}
+	if target, err := os.Readlink(path.Join(dest, "link")); err != nil || target != "sub/script" {
+		t.Errorf("expected 'link' to be a symlink to 'sub/script', got '%s' (%v)", target, err)
+	}
+	if _, err := os.Lstat(path.Join(dest, ".git")); !os.IsNotExist(err) {
+		t.Errorf("expected '.git' not to be copied, got %v", err)
+	}
+
+	sourceHash, err := hashTree(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	destHash, err := hashTree(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sourceHash != destHash {
+		t.Errorf("expected the copy to have hash '%s', got '%s'", sourceHash, destHash)
+	}
+}
+
+func TestCachedHashTree(t *testing.T) {
+	root := makeTestTree(t)
+	hash, err := cachedHashTree(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(root, "file"), []byte("other"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cached, err := cachedHashTree(root); err != nil || cached != hash {
+		t.Errorf("expected the cached hash '%s', got '%s' (%v)", hash, cached, err)
+	}
+}
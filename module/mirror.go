@@ -0,0 +1,98 @@
+package module
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path"
+
+	"github.com/daedaleanai/dbt/v3/config"
+	"github.com/daedaleanai/dbt/v3/util"
+)
+
+const mirrorLockFileSuffix = ".lock"
+
+// Prefixes of the names of mirror entries, which are followed by the sha256 hash of the url of the module.
+const gitMirrorPrefix = "git-"
+const tarMirrorPrefix = "tar-"
+
+// Mirror gives read-only access to all versions of a module stored in the local mirror
+// without checking any of them out.
+type Mirror interface {
+	Path() string
+
+	// Update fetches new versions of the module from its remote.
+	Update() error
+
+	RevParse(rev string) (string, error)
+	IsAncestor(ancestor, rev string) bool
+	HasRevision(hash string) bool
+
+	// ReadModuleFile reads the MODULE file of the module at version `hash`.
+	ReadModuleFile(hash string) (ModuleFile, error)
+}
+
+// GetMirror returns the mirror of the module at `url`, creating it if necessary.
+// For subdirectory modules, `subdir` is the subdirectory of the repository that contains the module.
+// Mirrors must be configured for this to succeed.
+func GetMirror(url string, moduleTypeString string, subdir string) (Mirror, error) {
+	moduleType := DetermineModuleType(url, moduleTypeString)
+	switch {
+	case moduleType == GitModuleType:
+		mirror, err := getOrCreateGitMirror(url, nil)
+		if err != nil {
+			return nil, err
+		}
+		if mirror == nil {
+			return nil, errNoMirror()
+		}
+		return mirror.forSubdir(subdir), nil
+	case moduleType.IsArchive():
+		mirror, err := getOrCreateTarMirror(url, moduleType, "", nil)
+		if err != nil {
+			return nil, err
+		}
+		if mirror == nil {
+			return nil, errNoMirror()
+		}
+		return mirror, nil
+	case moduleType == LocalModuleType:
+		return getLocalMirror(url)
+	}
+	return nil, fmt.Errorf("unsupported module type for url '%s'", url)
+}
+
+func errNoMirror() error {
+	if config.GetConfig().Mirror != "" {
+		return fmt.Errorf("the mirror does not exist and cannot be created in offline mode")
+	}
+	return fmt.Errorf("mirrors are not configured")
+}
+
+// mirrorEntryPath returns the path of the mirror entry for `url` with the name prefix `prefix`
+// in the writable mirror.
+func mirrorEntryPath(prefix string, url string) string {
+	return path.Join(config.GetConfig().Mirror, mirrorEntryName(prefix, url))
+}
+
+func mirrorEntryName(prefix string, url string) string {
+	urlHash := sha256.Sum256([]byte(url))
+	return fmt.Sprintf("%s%x", prefix, urlHash[:])
+}
+
+// findReadOnlyMirrorEntry returns the path of the mirror entry for `url` with the name prefix `prefix`
+// in the first read-only mirror layer that contains it. Entries in read-only layers are never locked
+// or modified.
+func findReadOnlyMirrorEntry(prefix string, url string) (string, bool) {
+	for _, layer := range config.GetConfig().ReadOnlyMirrors() {
+		entryPath := path.Join(layer, mirrorEntryName(prefix, url))
+		if util.DirExists(entryPath) {
+			return entryPath, true
+		}
+	}
+	return "", false
+}
+
+// lockMirror acquires the lock of the mirror entry at `mirrorPath`, which guards the creation of the entry.
+func lockMirror(mirrorPath string, url string) (*util.FileLock, error) {
+	return util.LockFile(mirrorPath+mirrorLockFileSuffix, fmt.Sprintf("Waiting for another dbt process to mirror '%s'...\n", url))
+}
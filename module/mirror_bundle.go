@@ -0,0 +1,354 @@
+package module
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/daedaleanai/dbt/v3/config"
+	"github.com/daedaleanai/dbt/v3/log"
+	"github.com/daedaleanai/dbt/v3/util"
+	"gopkg.in/yaml.v2"
+)
+
+// A mirror bundle contains mirror entries in a single file, so that they can be moved to machines
+// without network access. It is an uncompressed tar archive that contains an index file, a git bundle
+// for every git mirror and the archive of every archive mirror.
+const mirrorBundleIndexFileName = "index.yaml"
+const mirrorBundleVersion = 1
+
+// Git bundles contain refs with this prefix for all exported hashes, so that hashes that are not reachable
+// from any branch or tag (e.g., of deleted branches) are exported as well.
+const mirrorBundleRefPrefix = "refs/dbt-bundle/"
+
+type mirrorBundleIndex struct {
+	Version int
+	Entries []mirrorBundleEntry
+}
+
+type mirrorBundleEntry struct {
+	URL string
+	// Module type of the entry (e.g., 'git' or 'tar.gz').
+	Type string
+	// Name of the file of the entry inside of the bundle.
+	File string
+	// Versions of the module that are contained in the bundle.
+	Hashes []string
+}
+
+// MirrorBundleModule is a version of a module that is exported to a mirror bundle.
+type MirrorBundleModule struct {
+	Name, URL, Type, Hash string
+}
+
+// ExportMirrorBundle writes the mirror entries of `modules` to the mirror bundle `bundlePath` and returns
+// the number of exported modules. Local modules are skipped. Missing mirror entries are created, and mirrors
+// that do not contain the required versions are updated.
+func ExportMirrorBundle(bundlePath string, modules []MirrorBundleModule) (int, error) {
+	index := mirrorBundleIndex{Version: mirrorBundleVersion, Entries: []mirrorBundleEntry{}}
+	mirrors := []Mirror{}
+	entries := map[string]int{}
+	exported := 0
+	for _, mod := range modules {
+		moduleType := DetermineModuleType(mod.URL, mod.Type)
+		if moduleType == LocalModuleType {
+			log.Debug("Module '%s' is a local module, which is not mirrored.\n", mod.Name)
+			continue
+		}
+		if mod.Hash == "" {
+			return 0, fmt.Errorf("module '%s' has no hash", mod.Name)
+		}
+
+		mirror, err := GetMirror(mod.URL, mod.Type, "")
+		if err != nil {
+			return 0, fmt.Errorf("module '%s': %s", mod.Name, err)
+		}
+		if !mirror.HasRevision(mod.Hash) {
+			if err := mirror.Update(); err != nil {
+				return 0, fmt.Errorf("module '%s': %s", mod.Name, err)
+			}
+			if !mirror.HasRevision(mod.Hash) {
+				return 0, fmt.Errorf("module '%s': the mirror of '%s' does not contain hash '%s'", mod.Name, mod.URL, mod.Hash)
+			}
+		}
+
+		exported++
+
+		idx, exists := entries[mirror.Path()]
+		if !exists {
+			idx = len(index.Entries)
+			entries[mirror.Path()] = idx
+			index.Entries = append(index.Entries, mirrorBundleEntry{URL: mod.URL, Type: moduleType.String()})
+			mirrors = append(mirrors, mirror)
+		}
+		if !slices.Contains(index.Entries[idx].Hashes, mod.Hash) {
+			index.Entries[idx].Hashes = append(index.Entries[idx].Hashes, mod.Hash)
+		}
+	}
+
+	tempDir, err := os.MkdirTemp("", "dbt-bundle-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	files := []string{}
+	for idx := range index.Entries {
+		entry := &index.Entries[idx]
+		switch mirror := mirrors[idx].(type) {
+		case *GitMirror:
+			entry.File = fmt.Sprintf("%d.bundle", idx)
+			if err := mirror.createBundle(path.Join(tempDir, entry.File), entry.Hashes); err != nil {
+				return 0, err
+			}
+			files = append(files, path.Join(tempDir, entry.File))
+		case *TarMirror:
+			entry.File = fmt.Sprintf("%d.archive", idx)
+			files = append(files, mirror.archivePath())
+		}
+		log.Log("Exporting '%s'.\n", entry.URL)
+	}
+
+	indexPath := path.Join(tempDir, mirrorBundleIndexFileName)
+	util.WriteYaml(indexPath, index)
+
+	// Write the bundle to a temporary file first, so that no partial bundle is left behind on failures.
+	tempBundlePath := bundlePath + ".tmp"
+	if err := writeMirrorBundle(tempBundlePath, index, indexPath, files); err != nil {
+		os.Remove(tempBundlePath)
+		return 0, err
+	}
+	return exported, os.Rename(tempBundlePath, bundlePath)
+}
+
+func writeMirrorBundle(bundlePath string, index mirrorBundleIndex, indexPath string, files []string) error {
+	bundle, err := os.Create(bundlePath)
+	if err != nil {
+		return err
+	}
+	defer bundle.Close()
+
+	writer := tar.NewWriter(bundle)
+	if err := addFileToTar(writer, mirrorBundleIndexFileName, indexPath); err != nil {
+		return err
+	}
+	for idx, entry := range index.Entries {
+		if err := addFileToTar(writer, entry.File, files[idx]); err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return bundle.Close()
+}
+
+func addFileToTar(writer *tar.Writer, name, filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{Name: name, Mode: 0664, Size: info.Size(), ModTime: info.ModTime(), Typeflag: tar.TypeReg}
+	if err := writer.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, file)
+	return err
+}
+
+// createBundle writes all branches and tags of the mirror and the commits `hashes` to the git bundle
+// `bundlePath`. Git bundles only contain commits that are reachable from a ref, so a ref is created for
+// every hash. The refs are created in a temporary clone that shares the objects of the mirror, so the
+// mirror itself is not changed.
+func (m *GitMirror) createBundle(bundlePath string, hashes []string) error {
+	repo := GitModule{path: bundlePath + ".git"}
+	defer os.RemoveAll(repo.path)
+	if _, stderr, err := m.repo().tryRunGitCommand("clone", "--mirror", "--shared", "--quiet", m.path, repo.path); err != nil {
+		return fmt.Errorf("failed to clone mirror '%s': %s", m.path, stderr)
+	}
+	for _, hash := range hashes {
+		if _, stderr, err := repo.tryRunGitCommand("update-ref", mirrorBundleRefPrefix+hash, hash); err != nil {
+			return fmt.Errorf("failed to create a ref for hash '%s' of '%s': %s", hash, m.url(), stderr)
+		}
+	}
+	if _, stderr, err := repo.tryRunGitCommand("bundle", "create", bundlePath, "--branches", "--tags", "--glob="+mirrorBundleRefPrefix+"*"); err != nil {
+		return fmt.Errorf("failed to create git bundle of '%s': %s", m.url(), stderr)
+	}
+	return nil
+}
+
+// ImportMirrorBundle installs all entries of the mirror bundle `bundlePath` into the mirror and returns
+// the urls of the imported entries. Existing git mirrors are updated with the branches and tags of the
+// bundle, and existing archive mirrors are replaced if they contain a different archive.
+func ImportMirrorBundle(bundlePath string) ([]string, error) {
+	if config.GetConfig().Mirror == "" {
+		return nil, errNoMirror()
+	}
+
+	tempDir, err := os.MkdirTemp("", "dbt-bundle-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+	if err := extractMirrorBundle(bundlePath, tempDir); err != nil {
+		return nil, fmt.Errorf("failed to extract mirror bundle '%s': %s", bundlePath, err)
+	}
+
+	var index mirrorBundleIndex
+	data, err := os.ReadFile(path.Join(tempDir, mirrorBundleIndexFileName))
+	if err != nil {
+		return nil, fmt.Errorf("'%s' is not a mirror bundle: %s", bundlePath, err)
+	}
+	if err := yaml.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse the index of mirror bundle '%s': %s", bundlePath, err)
+	}
+	if index.Version != mirrorBundleVersion {
+		return nil, fmt.Errorf("mirror bundle '%s' has unsupported version %d", bundlePath, index.Version)
+	}
+
+	urls := []string{}
+	for _, entry := range index.Entries {
+		filePath := path.Join(tempDir, entry.File)
+		if path.Base(entry.File) != entry.File || strings.HasPrefix(entry.File, ".") || !util.FileExists(filePath) {
+			return urls, fmt.Errorf("mirror bundle '%s' does not contain file '%s' of '%s'", bundlePath, entry.File, entry.URL)
+		}
+		log.Log("Importing '%s'.\n", entry.URL)
+		moduleType := DetermineModuleType(entry.URL, entry.Type)
+		switch {
+		case moduleType == GitModuleType:
+			err = importGitMirror(entry.URL, filePath, entry.Hashes)
+		case moduleType.IsArchive():
+			err = importTarMirror(entry.URL, moduleType, filePath, entry.Hashes)
+		default:
+			err = fmt.Errorf("unsupported module type '%s'", entry.Type)
+		}
+		if err != nil {
+			return urls, fmt.Errorf("failed to import '%s': %s", entry.URL, err)
+		}
+		urls = append(urls, entry.URL)
+	}
+	return urls, nil
+}
+
+// extractMirrorBundle extracts the files of the mirror bundle `bundlePath` into `dir`.
+func extractMirrorBundle(bundlePath, dir string) error {
+	bundle, err := os.Open(bundlePath)
+	if err != nil {
+		return err
+	}
+	defer bundle.Close()
+
+	reader := tar.NewReader(bundle)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// All files of a bundle are stored at its top level.
+		if header.Typeflag != tar.TypeReg || strings.ContainsRune(header.Name, '/') || strings.HasPrefix(header.Name, ".") {
+			return fmt.Errorf("unexpected entry '%s'", header.Name)
+		}
+		file, err := os.Create(path.Join(dir, header.Name))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(file, reader)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// importGitMirror clones the git bundle `bundleFile` into the mirror of `url`, or fetches it into the
+// mirror if it already exists, and checks that the mirror contains all `hashes` afterwards.
+func importGitMirror(url, bundleFile string, hashes []string) error {
+	mirrorPath := mirrorEntryPath(gitMirrorPrefix, url)
+	lock, err := lockMirror(mirrorPath, url)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	mirror := &GitMirror{path: mirrorPath}
+	if util.DirExists(mirrorPath) {
+		log.Debug("Fetching git bundle into mirror '%s'.\n", mirrorPath)
+		refspecs := []string{"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*", "+" + mirrorBundleRefPrefix + "*:" + mirrorBundleRefPrefix + "*"}
+		if _, stderr, err := mirror.repo().tryRunGitCommand(append([]string{"fetch", bundleFile}, refspecs...)...); err != nil {
+			return fmt.Errorf("failed to fetch git bundle: %s", stderr)
+		}
+	} else {
+		log.Debug("Cloning git bundle as mirror '%s'.\n", mirrorPath)
+		if err := os.MkdirAll(mirrorPath, moduleDirMode); err != nil {
+			return err
+		}
+		_, stderr, err := mirror.repo().tryRunGitCommand("clone", "--mirror", bundleFile, mirrorPath)
+		if err == nil {
+			_, stderr, err = mirror.repo().tryRunGitCommand("remote", "set-url", "origin", url)
+		}
+		if err != nil {
+			os.RemoveAll(mirrorPath)
+			return fmt.Errorf("failed to clone git bundle: %s", stderr)
+		}
+	}
+
+	for _, hash := range hashes {
+		if !mirror.HasRevision(hash) {
+			return fmt.Errorf("the mirror does not contain hash '%s' after the import", hash)
+		}
+	}
+	recordMirrorUsage(mirrorPath, url, nil)
+	return nil
+}
+
+// importTarMirror extracts the archive `archiveFile` into the mirror of `url`, unless the mirror already
+// contains an archive with the expected hash.
+func importTarMirror(url string, moduleType ModuleType, archiveFile string, hashes []string) error {
+	if len(hashes) != 1 {
+		return fmt.Errorf("expected a single hash for an archive, but found %d", len(hashes))
+	}
+	mirrorPath := mirrorEntryPath(tarMirrorPrefix, url)
+	lock, err := lockMirror(mirrorPath, url)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	mirror := &TarMirror{path: mirrorPath}
+	if util.DirExists(mirrorPath) && util.FileExists(mirror.archivePath()) && mirror.HasRevision(hashes[0]) {
+		log.Debug("Mirror '%s' already contains the archive.\n", mirrorPath)
+		recordMirrorUsage(mirrorPath, url, nil)
+		return nil
+	}
+
+	if err := os.RemoveAll(mirrorPath); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(mirrorPath, moduleDirMode); err != nil {
+		return err
+	}
+	err = copyFile(archiveFile, mirror.archivePath(), 0664)
+	if err == nil {
+		err = mirror.module().extractArchive(url, mirror.archivePath(), moduleType, hashes[0])
+	}
+	if err != nil {
+		os.RemoveAll(mirrorPath)
+		os.Remove(mirror.archivePath())
+		return err
+	}
+	recordMirrorUsage(mirrorPath, url, nil)
+	return nil
+}
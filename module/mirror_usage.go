@@ -0,0 +1,332 @@
+package module
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/daedaleanai/dbt/v3/config"
+	"github.com/daedaleanai/dbt/v3/log"
+	"github.com/daedaleanai/dbt/v3/util"
+	"gopkg.in/yaml.v2"
+)
+
+// The url and the time of the last use of a mirror entry are stored next to the entry, so that
+// entries can be identified and removed once they are not used anymore.
+const mirrorUsageSuffix = ".usage"
+
+// Recording the use of a mirror entry takes its lock and rewrites a file, which is slow for mirrors on
+// network file systems. The use is only recorded again once the recorded last use is older than this.
+const mirrorUsageRecordInterval = 24 * time.Hour
+
+// The list of workspaces that use the mirror is stored in the mirror directory.
+const mirrorWorkspacesFileName = "workspaces.yaml"
+
+type mirrorUsage struct {
+	URL      string
+	LastUsed time.Time `yaml:"last-used"`
+	// Time of the last update of a git mirror from its remote.
+	LastUpdated time.Time `yaml:"last-updated,omitempty"`
+}
+
+// MirrorEntry is an entry of the local mirror (i.e., a mirrored git repository or archive).
+type MirrorEntry struct {
+	Path string
+	URL  string
+	// Total size of the entry and the files next to it in bytes.
+	Size     int64
+	LastUsed time.Time
+}
+
+// readMirrorUsage reads the recorded usage of the mirror entry at `mirrorPath`.
+func readMirrorUsage(mirrorPath string) (mirrorUsage, bool) {
+	var usage mirrorUsage
+	data, err := os.ReadFile(mirrorPath + mirrorUsageSuffix)
+	if err != nil || yaml.Unmarshal(data, &usage) != nil {
+		return mirrorUsage{}, false
+	}
+	return usage, true
+}
+
+// recentlyUsed returns whether the recorded last use of the mirror entry at `mirrorPath` is more recent
+// than the interval in which uses are recorded. The use of an entry is only recorded once the entry is
+// complete, so such entries can be used without waiting for their lock.
+func recentlyUsed(mirrorPath string) bool {
+	usage, ok := readMirrorUsage(mirrorPath)
+	return ok && time.Since(usage.LastUsed) < mirrorUsageRecordInterval
+}
+
+// updateMirrorUsage applies `update` to the recorded usage of the mirror entry at `mirrorPath` for `url`.
+// The caller must hold the lock of the entry. Failures are ignored, since they must not prevent using the
+// mirror (e.g., a read-only mirror).
+func updateMirrorUsage(mirrorPath, url string, update func(usage *mirrorUsage), logger *log.Logger) {
+	usage, _ := readMirrorUsage(mirrorPath)
+	usage.URL = url
+	update(&usage)
+	data, err := yaml.Marshal(usage)
+	if err == nil {
+		err = os.WriteFile(mirrorPath+mirrorUsageSuffix, data, 0664)
+	}
+	if err != nil {
+		logger.Debug("Failed to record usage of mirror '%s': %s.\n", mirrorPath, err)
+	}
+}
+
+// recordMirrorUsage records that the mirror entry at `mirrorPath` for `url` has just been used, unless a
+// recent use has already been recorded.
+func recordMirrorUsage(mirrorPath, url string, logger *log.Logger) {
+	if recentlyUsed(mirrorPath) {
+		return
+	}
+	updateMirrorUsage(mirrorPath, url, func(usage *mirrorUsage) {
+		usage.LastUsed = time.Now().UTC()
+	}, logger)
+}
+
+// recordMirrorUpdate records that the mirror entry at `mirrorPath` for `url` has just been updated from its remote.
+func recordMirrorUpdate(mirrorPath, url string, logger *log.Logger) {
+	updateMirrorUsage(mirrorPath, url, func(usage *mirrorUsage) {
+		usage.LastUsed = time.Now().UTC()
+		usage.LastUpdated = usage.LastUsed
+	}, logger)
+}
+
+// ListMirrorEntries returns all entries of the local mirror. Entries that have been created by older
+// versions of dbt have no recorded usage, so their url is read from the entry and the time of their
+// last modification is used as the time of their last use.
+func ListMirrorEntries() ([]MirrorEntry, error) {
+	mirrorDir := config.GetConfig().Mirror
+	if mirrorDir == "" {
+		return nil, errNoMirror()
+	}
+	content, err := os.ReadDir(mirrorDir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []MirrorEntry{}
+	for _, file := range content {
+		name := file.Name()
+		if !file.IsDir() || !(strings.HasPrefix(name, gitMirrorPrefix) || strings.HasPrefix(name, tarMirrorPrefix)) {
+			continue
+		}
+		entry := MirrorEntry{Path: path.Join(mirrorDir, name)}
+
+		if usage, ok := readMirrorUsage(entry.Path); ok {
+			entry.URL = usage.URL
+			entry.LastUsed = usage.LastUsed
+		} else {
+			entry.URL = legacyMirrorURL(entry.Path)
+			if info, err := file.Info(); err == nil {
+				entry.LastUsed = info.ModTime()
+			}
+		}
+
+		for _, entryPath := range entry.paths() {
+			entry.Size += diskUsage(entryPath)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// legacyMirrorURL reads the url of the mirror entry at `mirrorPath` from the entry itself.
+func legacyMirrorURL(mirrorPath string) string {
+	if strings.HasPrefix(path.Base(mirrorPath), tarMirrorPrefix) {
+		var metadata metadataFile
+		if data, err := os.ReadFile(path.Join(mirrorPath, tarMetadataFileName)); err == nil && yaml.Unmarshal(data, &metadata) == nil {
+			return metadata.URL
+		}
+		return ""
+	}
+	url, _, _ := GitModule{path: mirrorPath}.tryRunGitCommand("config", "--get", "remote.origin.url")
+	return url
+}
+
+// IsGit returns whether the entry is a git mirror. Modules cloned from a git mirror borrow its objects,
+// so they are broken if the entry is removed.
+func (e MirrorEntry) IsGit() bool {
+	return strings.HasPrefix(path.Base(e.Path), gitMirrorPrefix)
+}
+
+// paths returns the paths of the entry and of all files next to it, except for its lock file.
+func (e MirrorEntry) paths() []string {
+	return []string{e.Path, e.Path + tarMirrorArchiveSuffix, e.Path + mirrorUsageSuffix}
+}
+
+// Remove removes the entry from the mirror. The lock file of the entry is kept, since other processes
+// might be waiting for it.
+func (e MirrorEntry) Remove() error {
+	lock, err := lockMirror(e.Path, e.URL)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	for _, entryPath := range e.paths() {
+		if err := os.RemoveAll(entryPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diskUsage returns the total size of all files inside of `filePath` in bytes.
+func diskUsage(filePath string) int64 {
+	size := int64(0)
+	filepath.WalkDir(filePath, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// MirrorEntryPath returns the path of the mirror entry that stores the module at `url`. Local modules
+// are not stored in the mirror, so an empty string is returned for them.
+func MirrorEntryPath(url string, moduleTypeString string) (string, error) {
+	if _, ok := ParseModuleTypeString(moduleTypeString); !ok && moduleTypeString != "" {
+		return "", fmt.Errorf("invalid module type '%s'", moduleTypeString)
+	}
+	moduleType := DetermineModuleType(url, moduleTypeString)
+	switch {
+	case moduleType == GitModuleType:
+		return mirrorEntryPath(gitMirrorPrefix, url), nil
+	case moduleType.IsArchive():
+		return mirrorEntryPath(tarMirrorPrefix, url), nil
+	}
+	return "", nil
+}
+
+// RegisterMirrorWorkspace adds `workspaceRoot` to the workspaces that use the mirror.
+// Failures are ignored, since they must not prevent using the workspace.
+func RegisterMirrorWorkspace(workspaceRoot string) {
+	if config.GetConfig().Mirror == "" {
+		return
+	}
+	err := updateMirrorWorkspaces(func(workspaces []string) []string {
+		for _, workspace := range workspaces {
+			if workspace == workspaceRoot {
+				return workspaces
+			}
+		}
+		return append(workspaces, workspaceRoot)
+	})
+	if err != nil {
+		log.Debug("Failed to register workspace '%s' in the mirror: %s.\n", workspaceRoot, err)
+	}
+}
+
+// MirrorWorkspaces returns all workspaces that use the mirror and still exist. Workspaces that
+// do not exist anymore are removed from the list.
+func MirrorWorkspaces() ([]string, error) {
+	existing := []string{}
+	err := updateMirrorWorkspaces(func(workspaces []string) []string {
+		for _, workspace := range workspaces {
+			if util.FileExists(path.Join(workspace, util.ModuleFileName)) {
+				existing = append(existing, workspace)
+			}
+		}
+		return existing
+	})
+	return existing, err
+}
+
+func updateMirrorWorkspaces(update func([]string) []string) error {
+	workspacesPath := path.Join(config.GetConfig().Mirror, mirrorWorkspacesFileName)
+	lock, err := util.LockFile(workspacesPath+mirrorLockFileSuffix, "Waiting for another dbt process to update the list of workspaces of the mirror...\n")
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	workspaces := []string{}
+	if data, err := os.ReadFile(workspacesPath); err == nil {
+		if err := yaml.Unmarshal(data, &workspaces); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	data, err := yaml.Marshal(update(workspaces))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(workspacesPath, data, 0664)
+}
+
+// ReferencedMirrorEntries returns the paths of all mirror entries that are referenced by the workspace at
+// `workspaceRoot`: the entries of the workspace module, of all modules in the DEPS/ directory (including
+// their git submodules) and of all of their dependencies. No modules are opened, so no mirror entries are
+// created or marked as used. Parts of the workspace that cannot be read (e.g., a broken MODULE file) are
+// skipped and reported in the returned error, but all other referenced entries are still returned.
+func ReferencedMirrorEntries(workspaceRoot string) (map[string]bool, error) {
+	referenced := map[string]bool{}
+	errs := []error{}
+	addDependencies := func(modulePath string) {
+		moduleFile, err := tryReadModuleFile(modulePath)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		for name, dep := range moduleFile.Dependencies {
+			entryPath, err := MirrorEntryPath(dep.ResolvedURL(), dep.Type)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("dependency '%s' of '%s': %s", name, modulePath, err))
+			} else if entryPath != "" {
+				referenced[entryPath] = true
+			}
+		}
+	}
+	addGitRepository := func(repoPath string) {
+		repo := GitModule{path: repoPath}
+		if url, _, err := repo.tryRunGitCommand("config", "--get", "remote.origin.url"); err == nil {
+			referenced[mirrorEntryPath(gitMirrorPrefix, url)] = true
+		}
+		submodules, err := repo.Submodules()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("repository '%s': %s", repoPath, err))
+		}
+		for _, submodule := range submodules {
+			referenced[mirrorEntryPath(gitMirrorPrefix, submodule.URL)] = true
+		}
+	}
+
+	addDependencies(workspaceRoot)
+	addGitRepository(workspaceRoot)
+
+	depsDir := path.Join(workspaceRoot, util.DepsDirName)
+	modulePaths := []string{}
+	for _, dir := range []string{depsDir, path.Join(depsDir, SubdirReposDirName)} {
+		content, _ := os.ReadDir(dir)
+		for _, entry := range content {
+			if entry.IsDir() && entry.Name() != SubdirReposDirName {
+				modulePaths = append(modulePaths, path.Join(dir, entry.Name()))
+			}
+		}
+	}
+	for _, modulePath := range modulePaths {
+		addDependencies(modulePath)
+		if util.DirExists(path.Join(modulePath, ".git")) || util.FileExists(path.Join(modulePath, ".git")) {
+			addGitRepository(modulePath)
+		} else if metadataPath := path.Join(modulePath, tarMetadataFileName); util.FileExists(metadataPath) {
+			var metadata metadataFile
+			if err := readMetadataFile(metadataPath, &metadata); err != nil {
+				errs = append(errs, fmt.Errorf("module '%s': %s", modulePath, err))
+			} else {
+				referenced[mirrorEntryPath(tarMirrorPrefix, metadata.URL)] = true
+			}
+		}
+	}
+	return referenced, errors.Join(errs...)
+}
@@ -2,6 +2,7 @@ package module
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/exec"
 	"path"
@@ -9,8 +10,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/daedaleanai/dbt/v3/config"
 	"github.com/daedaleanai/dbt/v3/log"
 	"github.com/daedaleanai/dbt/v3/util"
+	"gopkg.in/yaml.v2"
 )
 
 const setupFileName = "SETUP.go"
@@ -18,6 +21,9 @@ const setupSentinelFileName = ".setup"
 const rulesDirName = "RULES"
 const buildFileName = "BUILD.go"
 
+// Permissions of the directories of modules and mirror entries.
+const moduleDirMode = 0775
+
 type GoFile struct {
 	// Absolute path to file
 	SourcePath string
@@ -41,8 +47,9 @@ type Module interface {
 	RevParse(rev string) string
 	IsDirty() bool
 	IsAncestor(ancestor, rev string) bool
+	HasRevision(hash string) bool
 
-	Fetch() bool
+	Fetch() (bool, error)
 	Checkout(hash string)
 
 	RootPath() string
@@ -293,31 +300,44 @@ func OpenModuleByName(moduleName string) Module {
 
 // OpenModule opens a module checked out on disk.
 func OpenModule(modulePath string) Module {
-	log.Debug("Opening module '%s'.\n", modulePath)
+	module, err := OpenModuleWithLogger(modulePath, nil)
+	if err != nil {
+		log.Fatal("Failed to open module: %s. Remove the module directory and rerun 'dbt sync'.\n", err)
+	}
+	return module
+}
+
+// OpenModuleWithLogger works like OpenModule, but returns an error instead of terminating the program
+// if the module is broken. The module prints all messages to `logger`.
+func OpenModuleWithLogger(modulePath string, logger *log.Logger) (Module, error) {
+	logger.Debug("Opening module '%s'.\n", modulePath)
 
-	if util.DirExists(path.Join(modulePath, ".git")) {
-		log.Debug("Found '.git' directory. Expecting this to be a GitModule.\n")
-		module := GitModule{path: modulePath}
-		mirror, _ := getOrCreateGitMirror(module.URL())
-		return GitModule{path: modulePath, mirror: mirror}
+	if subdir, isSubdir := linkedSubdir(modulePath); isSubdir {
+		logger.Debug("Found symlink to subdirectory '%s' of a repository. Expecting this to be a GitModule.\n", subdir)
+		return openSubdirModule(modulePath, subdir, logger), nil
 	}
 
-	if util.FileExists(path.Join(modulePath, ".git")) {
-		log.Debug("Found '.git' worktree file. Expecting this to be a GitModule.\n")
-		module := GitModule{path: modulePath}
-		mirror, _ := getOrCreateGitMirror(module.URL())
-		return GitModule{path: modulePath, mirror: mirror}
+	if util.DirExists(path.Join(modulePath, ".git")) || util.FileExists(path.Join(modulePath, ".git")) {
+		logger.Debug("Found '.git' directory or worktree file. Expecting this to be a GitModule.\n")
+		return openGitModule(modulePath, logger), nil
+	}
+
+	if util.FileExists(path.Join(modulePath, localMetadataFileName)) {
+		logger.Debug("Found '%s' file. Expecting this to be a LocalModule.\n", localMetadataFileName)
+		return LocalModule{path: modulePath, logger: logger}, nil
 	}
 
 	if util.FileExists(path.Join(modulePath, tarMetadataFileName)) {
-		log.Debug("Found '%s' file. Expecting this to be a TarModule.\n", tarMetadataFileName)
-		module := TarModule{path: modulePath}
-		mirror, _ := getOrCreateTarMirror(module.URL())
-		return TarModule{path: modulePath, mirror: mirror}
+		logger.Debug("Found '%s' file. Expecting this to be a TarModule.\n", tarMetadataFileName)
+		var metadata metadataFile
+		if err := readMetadataFile(path.Join(modulePath, tarMetadataFileName), &metadata); err != nil {
+			return nil, fmt.Errorf("module '%s' appears to be broken: %s", modulePath, err)
+		}
+		mirror, _ := getOrCreateTarMirror(metadata.URL, metadata.moduleType(), metadata.Sha256, logger)
+		return TarModule{path: modulePath, mirror: mirror, logger: logger}, nil
 	}
 
-	log.Fatal("Module appears to be broken. Remove the module directory and rerun 'dbt sync'.\n")
-	return nil
+	return nil, fmt.Errorf("module '%s' appears to be broken", modulePath)
 }
 
 type ModuleType uint
@@ -325,25 +345,59 @@ type ModuleType uint
 const (
 	GitModuleType ModuleType = iota
 	TarGzModuleType
+	ZipModuleType
+	TarXzModuleType
+	TarBz2ModuleType
+	TarZstModuleType
+	LocalModuleType
 )
 
+// All module types that are backed by an archive. Their string representation is also the URL suffix.
+var archiveModuleTypes = []ModuleType{TarGzModuleType, ZipModuleType, TarXzModuleType, TarBz2ModuleType, TarZstModuleType}
+
 func (t ModuleType) String() string {
 	switch t {
 	case GitModuleType:
 		return "git"
 	case TarGzModuleType:
 		return "tar.gz"
+	case ZipModuleType:
+		return "zip"
+	case TarXzModuleType:
+		return "tar.xz"
+	case TarBz2ModuleType:
+		return "tar.bz2"
+	case TarZstModuleType:
+		return "tar.zst"
+	case LocalModuleType:
+		return "local"
 	}
 
 	log.Fatal("Invalid module type: %s\n", t)
 	return ""
 }
 
+// IsArchive returns whether modules of type `t` are backed by an archive (i.e., are TarModules).
+func (t ModuleType) IsArchive() bool {
+	for _, moduleType := range archiveModuleTypes {
+		if t == moduleType {
+			return true
+		}
+	}
+	return false
+}
+
 func ParseModuleTypeString(str string) (ModuleType, bool) {
 	if str == "git" {
 		return GitModuleType, true
-	} else if str == "tar.gz" {
-		return TarGzModuleType, true
+	}
+	if str == "local" {
+		return LocalModuleType, true
+	}
+	for _, moduleType := range archiveModuleTypes {
+		if str == moduleType.String() {
+			return moduleType, true
+		}
 	}
 
 	return GitModuleType, false
@@ -362,9 +416,15 @@ func DetermineModuleType(url, moduleTypeString string) ModuleType {
 		log.Debug("Module URL ends in '.git'. Trying to create a new git module.\n")
 		return GitModuleType
 	}
-	if strings.HasSuffix(url, ".tar.gz") {
-		log.Debug("Module URL ends in '.tar.gz'. Trying to create a new TarModule.\n")
-		return TarGzModuleType
+	for _, moduleType := range archiveModuleTypes {
+		if strings.HasSuffix(url, "."+moduleType.String()) {
+			log.Debug("Module URL ends in '.%s'. Trying to create a new TarModule.\n", moduleType)
+			return moduleType
+		}
+	}
+	if strings.HasPrefix(url, localUrlPrefix) || path.IsAbs(url) {
+		log.Debug("Module URL is a local path. Trying to create a new LocalModule.\n")
+		return LocalModuleType
 	}
 
 	log.Fatal("Failed to determine module type from dependency url '%s'.\n", url)
@@ -373,39 +433,181 @@ func DetermineModuleType(url, moduleTypeString string) ModuleType {
 
 // OpenOrCreateModule tries to open the module in `modulePath`. If the `modulePath` directory does
 // not yet exists, it tries to create a new module by cloning / downloading the module from `url`.
-func OpenOrCreateModule(modulePath string, url string, moduleTypeString string, expectedHash string) Module {
+func OpenOrCreateModule(modulePath string, url string, moduleTypeString string, expectedHash string, cloneMode CloneMode) Module {
+	module, created := OpenOrCloneModule(modulePath, url, moduleTypeString, expectedHash, cloneMode)
+	if created {
+		SetupNewModule(module, expectedHash)
+	}
+	return module
+}
+
+// OpenOrCloneModule works like OpenOrCreateModule but does not run the SETUP.go file of a newly
+// created module. It reports whether the module had to be created.
+func OpenOrCloneModule(modulePath string, url string, moduleTypeString string, expectedHash string, cloneMode CloneMode) (Module, bool) {
 	log.Debug("Opening or creating module '%s' from url '%s'.\n", modulePath, url)
 	if util.DirExists(modulePath) {
 		log.Debug("Module directory exists.\n")
-		return OpenModule(modulePath)
+		return OpenModule(modulePath), false
 	}
 
 	log.Debug("Module directory does not exists.\n")
 
+	module, err := CloneModule(modulePath, url, moduleTypeString, expectedHash, cloneMode, nil)
+	if err != nil {
+		log.Fatal("%s.\n", err)
+	}
+	return module, true
+}
+
+// CloneModule creates a new module in `modulePath` by cloning / downloading the module from `url`.
+// Archives are only extracted if their hash matches `expectedHash` (unless it is empty).
+// Git repositories are cloned using the clone mode `cloneMode`.
+// If creating the module fails, the `modulePath` directory is removed so that the operation can be retried.
+// The module prints all messages to `logger`.
+func CloneModule(modulePath string, url string, moduleTypeString string, expectedHash string, cloneMode CloneMode, logger *log.Logger) (Module, error) {
 	moduleType := DetermineModuleType(url, moduleTypeString)
 
 	if moduleType == GitModuleType {
-		module, err := CreateGitModule(modulePath, url)
+		module, err := CreateGitModule(modulePath, url, cloneMode, logger)
 		if err != nil {
 			os.RemoveAll(modulePath)
-			log.Fatal("Failed to create git module: %s.\n", err)
+			return nil, fmt.Errorf("failed to create git module: %s", err)
 		}
-		if module.Head() == expectedHash {
-			SetupModule(modulePath)
+		return module, nil
+	} else if moduleType.IsArchive() {
+		module, err := createTarModule(modulePath, url, moduleType, expectedHash, logger)
+		if err != nil {
+			os.RemoveAll(modulePath)
+			return nil, fmt.Errorf("failed to create %s module: %s", moduleType, err)
 		}
-		return module
-	} else if moduleType == TarGzModuleType {
-		module, err := createTarModule(modulePath, url)
+		return module, nil
+	} else if moduleType == LocalModuleType {
+		module, err := createLocalModule(modulePath, url, expectedHash, logger)
 		if err != nil {
 			os.RemoveAll(modulePath)
-			log.Fatal("Failed to create tar module: %s.\n", err)
+			return nil, fmt.Errorf("failed to create local module: %s", err)
+		}
+		return module, nil
+	}
+
+	return nil, fmt.Errorf("unhandled module type %v", moduleType)
+}
+
+// isDirty works like module.IsDirty, but returns an error instead of terminating the program.
+func isDirty(module Module) (bool, error) {
+	switch module := module.(type) {
+	case GitModule:
+		return module.isDirty()
+	case LocalModule:
+		return module.isDirty()
+	}
+	return module.IsDirty(), nil
+}
+
+// SetupNewModule runs the SETUP.go file of a newly created module. Git modules that are not yet
+// at `expectedHash` are set up later on, once they are checked out at the expected version.
+func SetupNewModule(module Module, expectedHash string) {
+	if module.Type() == GitModuleType && module.Head() != expectedHash {
+		return
+	}
+	SetupModule(module.RootPath())
+}
+
+// IsModule reports whether `modulePath` contains a module that can be opened with OpenModule.
+func IsModule(modulePath string) bool {
+	return IsSubdirLink(modulePath) ||
+		util.DirExists(path.Join(modulePath, ".git")) ||
+		util.FileExists(path.Join(modulePath, ".git")) ||
+		util.FileExists(path.Join(modulePath, tarMetadataFileName)) ||
+		util.FileExists(path.Join(modulePath, localMetadataFileName))
+}
+
+// ReadHead returns the version of the module in `modulePath` like Head. Unlike OpenModule, it reports
+// failures instead of terminating the program, so it can be used while recovering from a fatal error.
+func ReadHead(modulePath string) (string, error) {
+	repoPath := modulePath
+	if IsSubdirLink(modulePath) {
+		repoPath = SubdirRepoPath(modulePath)
+	}
+	if util.DirExists(path.Join(repoPath, ".git")) || util.FileExists(path.Join(repoPath, ".git")) {
+		stdout, stderr, err := GitModule{path: repoPath}.tryRunGitCommand("rev-list", "-n", "1", "HEAD")
+		if err != nil {
+			return "", fmt.Errorf("failed to read HEAD of '%s': %s", repoPath, stderr)
+		}
+		return stdout, nil
+	}
+	if util.FileExists(path.Join(modulePath, localMetadataFileName)) {
+		var metadata localMetadataFile
+		err := readMetadataFile(path.Join(modulePath, localMetadataFileName), &metadata)
+		return metadata.Hash, err
+	}
+	if util.FileExists(path.Join(modulePath, tarMetadataFileName)) {
+		var metadata metadataFile
+		err := readMetadataFile(path.Join(modulePath, tarMetadataFileName), &metadata)
+		return metadata.Sha256, err
+	}
+	return "", fmt.Errorf("'%s' is not a module", modulePath)
+}
+
+// readMetadataFile reads the YAML file `filePath` that describes the origin of a module into `v`.
+func readMetadataFile(filePath string, v interface{}) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(data, v)
+}
+
+// writeMetadataFile writes `v` to the YAML file `filePath` that describes the origin of a module.
+func writeMetadataFile(filePath string, v interface{}) error {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, data, 0664)
+}
+
+// RestoreModule brings the module in `modulePath` back to version `hash`. If the module directory
+// does not exist anymore, the module is re-created from `url` first (using the mirror, if available and
+// the clone mode `cloneMode`).
+// Unlike most other functions in this package, RestoreModule reports failures instead of terminating
+// the program, so it can be used while recovering from a fatal error.
+func RestoreModule(modulePath string, url string, moduleTypeString string, hash string, cloneMode CloneMode) error {
+	moduleType, ok := ParseModuleTypeString(moduleTypeString)
+	if !ok {
+		return fmt.Errorf("invalid module type '%s'", moduleTypeString)
+	}
+	isGit := moduleType == GitModuleType
+	// Archives and local modules only have a single version, so they have to be re-created to restore
+	// a different version (e.g., a different version of a versioned archive).
+	if !isGit && util.DirExists(modulePath) && IsModule(modulePath) {
+		if head, err := ReadHead(modulePath); err != nil || head != hash {
+			if err := os.RemoveAll(modulePath); err != nil {
+				return err
+			}
 		}
-		SetupModule(modulePath)
-		return module
 	}
 
-	log.Fatal("Unhandled module type %v\n", moduleType)
-	return nil
+	if !util.DirExists(modulePath) {
+		if _, err := CloneModule(modulePath, url, moduleTypeString, hash, cloneMode, nil); err != nil {
+			return err
+		}
+	}
+
+	if !isGit {
+		return nil
+	}
+
+	module := GitModule{path: modulePath}
+	if !module.HasRevision(hash) && module.CloneMode() != FullClone {
+		if err := module.fetchRevision(hash); err != nil {
+			return err
+		}
+	}
+	if _, stderr, err := module.tryRunGitCommand("checkout", hash); err != nil {
+		return fmt.Errorf("failed to check out '%s': %s", hash, stderr)
+	}
+	return module.updateSubmodules()
 }
 
 // SetupModule runs the SETUP.go file in the root directory of `mod` (it if exists).
@@ -422,6 +624,7 @@ func SetupModule(modulePath string) {
 
 	cmd := exec.Command("go", "run", setupFilePath)
 	cmd.Dir = modulePath
+	cmd.Env = config.GoEnvironment()
 	cmd.Stderr = os.Stderr
 	cmd.Stdout = os.Stdout
 	err := cmd.Run()
@@ -447,15 +650,28 @@ func GetAllModules(workspaceRoot string) util.OrderedMap[string, Module] {
 		log.Fatal("Failed to read content of %s/ directory: %s.\n", util.DepsDirName, err)
 	}
 	modules := map[string]Module{}
+	overrides := GetOverrides(workspaceRoot)
 
 	for _, file := range files {
 		info, err := file.Info()
 		if err != nil {
 			log.Fatal("Failed to get file info for", file.Name())
 		}
-		if file.IsDir() || (info.Mode()&os.ModeSymlink) == os.ModeSymlink {
-			modules[file.Name()] = OpenModule(path.Join(depsDir, file.Name()))
+		if !file.IsDir() && (info.Mode()&os.ModeSymlink) != os.ModeSymlink {
+			continue
+		}
+		if file.Name() == SubdirReposDirName {
+			continue
+		}
+
+		modulePath := path.Join(depsDir, file.Name())
+		if localPath, overridden := overrides[file.Name()]; overridden && !IsOverrideLink(modulePath, localPath) {
+			// The DEPS/ directory is only changed by 'dbt sync' and 'dbt dep override'.
+			log.Warning("Module '%s' is overridden by '%s'. Run 'dbt sync' to replace the existing module.\n", file.Name(), localPath)
+			modules[file.Name()] = OpenModule(localPath)
+			continue
 		}
+		modules[file.Name()] = OpenModule(modulePath)
 	}
 
 	moduleFile := ReadModuleFile(workspaceRoot)
@@ -0,0 +1,79 @@
+package module
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/daedaleanai/dbt/v3/config"
+	"github.com/daedaleanai/dbt/v3/log"
+)
+
+// RetriedOperation is a network operation that failed at least once and has been retried.
+type RetriedOperation struct {
+	Description string
+	Attempts    int
+	// Error of the last attempt (nil if the operation eventually succeeded).
+	Err error
+}
+
+var retriedOperations []RetriedOperation
+var retriedOperationsMutex sync.Mutex
+
+// RetriedOperations returns all network operations that have been retried so far.
+func RetriedOperations() []RetriedOperation {
+	retriedOperationsMutex.Lock()
+	defer retriedOperationsMutex.Unlock()
+	return append([]RetriedOperation{}, retriedOperations...)
+}
+
+// permanentError is an error that does not go away by retrying the operation (e.g., a missing file).
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+// retryNetworkOperation runs `operation`, which accesses the network, and retries it with exponential
+// backoff if it fails with an error that is not permanent. The context passed to `operation` expires
+// once the network timeout for all attempts together has been exceeded. Retries are reported to `logger`.
+func retryNetworkOperation(logger *log.Logger, description string, operation func(ctx context.Context) error) error {
+	configuration := config.GetConfig()
+	ctx := context.Background()
+	if configuration.NetworkTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, configuration.NetworkTimeout)
+		defer cancel()
+	}
+
+	retries := configuration.NetworkRetries()
+	delay := configuration.NetworkRetryDelay()
+	attempt := 1
+	err := operation(ctx)
+	for err != nil && ctx.Err() == nil && attempt <= retries && !errors.As(err, &permanentError{}) {
+		logger.Warning("%s failed (attempt %d of %d): %s. Retrying in %s.\n", description, attempt, retries+1, err, delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+		delay *= 2
+		if ctx.Err() == nil {
+			attempt++
+			err = operation(ctx)
+		}
+	}
+	if err != nil && ctx.Err() != nil {
+		err = fmt.Errorf("timed out after %s: %s", configuration.NetworkTimeout, err)
+	}
+
+	if attempt > 1 {
+		retriedOperationsMutex.Lock()
+		retriedOperations = append(retriedOperations, RetriedOperation{Description: description, Attempts: attempt, Err: err})
+		retriedOperationsMutex.Unlock()
+	}
+	return err
+}
@@ -0,0 +1,92 @@
+package module
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/daedaleanai/dbt/v3/log"
+	"github.com/daedaleanai/dbt/v3/util"
+	"gopkg.in/yaml.v2"
+)
+
+// LocalModuleFile holds workspace-local settings that must not be committed.
+type LocalModuleFile struct {
+	// Local directories that replace dependencies, by dependency name.
+	Overrides map[string]string `yaml:"overrides,omitempty"`
+}
+
+// ReadLocalModuleFile reads the MODULE.local file of the workspace (if it exists).
+func ReadLocalModuleFile(workspaceRoot string) LocalModuleFile {
+	localModuleFile := LocalModuleFile{Overrides: map[string]string{}}
+	localModuleFilePath := path.Join(workspaceRoot, util.LocalModuleFileName)
+	if !util.FileExists(localModuleFilePath) {
+		return localModuleFile
+	}
+
+	err := yaml.UnmarshalStrict(util.ReadFile(localModuleFilePath), &localModuleFile)
+	if err != nil {
+		log.Fatal("Failed to read '%s': %s.\n", localModuleFilePath, err)
+	}
+	if localModuleFile.Overrides == nil {
+		localModuleFile.Overrides = map[string]string{}
+	}
+	return localModuleFile
+}
+
+// WriteLocalModuleFile writes the MODULE.local file of the workspace. The file is removed if it would be empty.
+func WriteLocalModuleFile(workspaceRoot string, localModuleFile LocalModuleFile) {
+	localModuleFilePath := path.Join(workspaceRoot, util.LocalModuleFileName)
+	if len(localModuleFile.Overrides) == 0 {
+		if err := os.Remove(localModuleFilePath); err != nil && !os.IsNotExist(err) {
+			log.Fatal("Failed to remove '%s': %s.\n", localModuleFilePath, err)
+		}
+		return
+	}
+	util.WriteYaml(localModuleFilePath, localModuleFile)
+}
+
+// GetOverrides returns the local directories that replace dependencies of the workspace, by dependency name.
+func GetOverrides(workspaceRoot string) map[string]string {
+	return ReadLocalModuleFile(workspaceRoot).Overrides
+}
+
+// IsOverrideLink returns whether `modulePath` is a symlink to `localPath`.
+func IsOverrideLink(modulePath, localPath string) bool {
+	target, err := os.Readlink(modulePath)
+	return err == nil && filepath.Clean(target) == filepath.Clean(localPath)
+}
+
+// IsSymlink returns whether `modulePath` is a symlink.
+func IsSymlink(modulePath string) bool {
+	info, err := os.Lstat(modulePath)
+	return err == nil && info.Mode()&os.ModeSymlink != 0
+}
+
+// LinkOverride replaces the module at `modulePath` by a symlink to `localPath`. An existing module
+// checkout is only removed if it has no local changes.
+func LinkOverride(modulePath, localPath string) error {
+	if !util.DirExists(localPath) || !IsModule(localPath) {
+		return fmt.Errorf("'%s' is not a module checkout", localPath)
+	}
+	if IsOverrideLink(modulePath, localPath) {
+		return nil
+	}
+
+	if IsSymlink(modulePath) {
+		if err := os.Remove(modulePath); err != nil {
+			return err
+		}
+	} else if util.DirExists(modulePath) {
+		if IsModule(modulePath) && OpenModule(modulePath).IsDirty() {
+			return fmt.Errorf("the existing module has local changes")
+		}
+		if err := os.RemoveAll(modulePath); err != nil {
+			return err
+		}
+	}
+
+	log.Debug("Creating symlink '%s' -> '%s'.\n", modulePath, localPath)
+	return os.Symlink(localPath, modulePath)
+}
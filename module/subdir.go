@@ -0,0 +1,99 @@
+package module
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/daedaleanai/dbt/v3/log"
+	"github.com/daedaleanai/dbt/v3/util"
+)
+
+// SubdirReposDirName is the directory inside the DEPS/ directory that holds the repositories of
+// subdirectory modules. The module directory itself is a symlink to the subdirectory of the repository.
+const SubdirReposDirName = ".repos"
+
+// SubdirRepoPath returns the path of the repository that contains the subdirectory module at `modulePath`.
+func SubdirRepoPath(modulePath string) string {
+	return path.Join(path.Dir(modulePath), SubdirReposDirName, path.Base(modulePath))
+}
+
+// IsSubdirLink returns whether `modulePath` is a symlink to a subdirectory of its repository.
+func IsSubdirLink(modulePath string) bool {
+	_, isSubdir := linkedSubdir(modulePath)
+	return isSubdir
+}
+
+// linkedSubdir returns the subdirectory of the repository that `modulePath` is a symlink to.
+func linkedSubdir(modulePath string) (string, bool) {
+	target, err := os.Readlink(modulePath)
+	if err != nil {
+		return "", false
+	}
+	return util.CutPrefix(target, SubdirRepoPath(modulePath)+"/")
+}
+
+func openSubdirModule(modulePath string, subdir string, logger *log.Logger) GitModule {
+	module := openGitModule(SubdirRepoPath(modulePath), logger)
+	module.subdir = subdir
+	return module
+}
+
+// OpenOrCloneSubdirModule opens the module in the subdirectory `subdir` of the repository at `url`,
+// cloning the repository using the clone mode `cloneMode` if necessary, and symlinks `modulePath` to
+// the subdirectory. It reports whether the repository had to be cloned. The module prints all messages to `logger`.
+func OpenOrCloneSubdirModule(modulePath, url, subdir string, cloneMode CloneMode, logger *log.Logger) (Module, bool, error) {
+	repoPath := SubdirRepoPath(modulePath)
+	currentSubdir, isSubdir := linkedSubdir(modulePath)
+
+	var module GitModule
+	created := false
+	if util.DirExists(repoPath) {
+		module = openSubdirModule(modulePath, subdir, logger)
+		if currentSubdir != subdir {
+			logger.Debug("Checking out subdirectory '%s'.\n", subdir)
+			if _, stderr, err := module.tryRunGitCommand("sparse-checkout", "set", "--cone", subdir); err != nil {
+				return nil, false, fmt.Errorf("failed to check out subdirectory '%s': %s", subdir, stderr)
+			}
+		}
+	} else {
+		mirror, err := getOrCreateGitMirror(url, logger)
+		if err != nil {
+			return nil, false, err
+		}
+		module = GitModule{path: repoPath, mirror: mirror, subdir: subdir, logger: logger}
+		if err := os.MkdirAll(repoPath, moduleDirMode); err != nil {
+			return nil, false, err
+		}
+		if err := module.clone(url, false, cloneMode); err != nil {
+			os.RemoveAll(repoPath)
+			return nil, false, fmt.Errorf("failed to create git module: %s", err)
+		}
+		created = true
+	}
+
+	if isSubdir && currentSubdir == subdir {
+		return module, created, nil
+	}
+	if !isSubdir && util.DirExists(modulePath) && !IsSymlink(modulePath) {
+		if IsModule(modulePath) {
+			existing, err := OpenModuleWithLogger(modulePath, logger)
+			if err != nil {
+				return nil, false, err
+			}
+			if dirty, err := isDirty(existing); err != nil {
+				return nil, false, fmt.Errorf("failed to check the existing module for local changes: %s", err)
+			} else if dirty {
+				return nil, false, fmt.Errorf("the existing module has local changes")
+			}
+		}
+	}
+	if err := os.RemoveAll(modulePath); err != nil {
+		return nil, false, err
+	}
+	logger.Debug("Creating symlink '%s' -> '%s'.\n", modulePath, module.RootPath())
+	if err := os.Symlink(module.RootPath(), modulePath); err != nil {
+		return nil, false, err
+	}
+	return module, created, nil
+}
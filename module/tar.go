@@ -2,7 +2,10 @@ package module
 
 import (
 	"archive/tar"
+	"archive/zip"
+	"compress/bzip2"
 	"compress/gzip"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
@@ -16,22 +19,40 @@ import (
 	"github.com/daedaleanai/dbt/v3/log"
 	"github.com/daedaleanai/dbt/v3/netrc"
 	"github.com/daedaleanai/dbt/v3/util"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
 )
 
 const tarMetadataFileName = ".metadata"
 
+// The archive of a mirrored module is kept next to the mirror directory, so that it can be verified
+// every time the module is extracted from the mirror.
+const tarMirrorArchiveSuffix = ".archive"
+
 const defaultDirMode = 0770
 
 type metadataFile struct {
 	URL    string
 	Sha256 string
+	// Archive type of the module. Empty for tar.gz archives.
+	Type string `yaml:",omitempty"`
+}
+
+// moduleType returns the archive type recorded in the metadata.
+func (metadata metadataFile) moduleType() ModuleType {
+	if moduleType, ok := ParseModuleTypeString(metadata.Type); ok && moduleType.IsArchive() {
+		return moduleType
+	}
+	return TarGzModuleType
 }
 
-// TarModule is a module backed by a tar.gz archive.
+// TarModule is a module backed by an archive (e.g., a tar.gz or zip file).
 // TarModules only have a single "master" version.
 type TarModule struct {
 	path   string
 	mirror *TarMirror
+	// Logger for the messages of the module (nil prints them right away).
+	logger *log.Logger
 }
 
 type TarMirror struct {
@@ -55,49 +76,131 @@ func stripRoot(p string) string {
 	return p[len(root):]
 }
 
-// Obtains a mirror for a tar module if the global mirror directory has been set up
-func getOrCreateTarMirror(url string) (*TarMirror, error) {
+// Obtains a mirror for a tar module if the global mirror directory has been set up.
+// If `expectedHash` is not empty, a newly downloaded archive must have that hash.
+// All messages are printed to `logger`.
+func getOrCreateTarMirror(url string, moduleType ModuleType, expectedHash string, logger *log.Logger) (*TarMirror, error) {
 	configuration := config.GetConfig()
 	if configuration.Mirror == "" {
-		log.Debug("Mirrors are not configured.\n")
+		logger.Debug("Mirrors are not configured.\n")
 		return nil, nil
 	}
 
-	urlHash := sha256.Sum256([]byte(url))
-	urlHashString := fmt.Sprintf("tar-%x", urlHash[:])
-	mirrorPath := path.Join(configuration.Mirror, urlHashString)
+	mirrorPath := mirrorEntryPath(tarMirrorPrefix, url)
+	if !util.DirExists(mirrorPath) {
+		// Entries in read-only mirror layers cannot be replaced, so they are only used if they contain the archive.
+		if readOnlyPath, found := findReadOnlyMirrorEntry(tarMirrorPrefix, url); found && util.FileExists(readOnlyPath+tarMirrorArchiveSuffix) {
+			logger.Debug("Mirror of '%s' found in read-only mirror layer at '%s'.\n", url, readOnlyPath)
+			return &TarMirror{path: readOnlyPath}, nil
+		}
+	}
+	logger.Debug("Looking for mirror of '%s' in directory '%s'.\n", url, mirrorPath)
+	mirror := &TarMirror{path: mirrorPath}
+	if recentlyUsed(mirrorPath) && util.FileExists(mirror.archivePath()) {
+		logger.Debug("Mirror found at '%s'.\n", mirrorPath)
+		return mirror, nil
+	}
 
-	log.Debug("Looking for mirror of '%s' in directory '%s'.\n", url, mirrorPath)
+	// Wait for other processes that are creating the same mirror.
+	lock, err := lockMirror(mirrorPath, url)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
 
 	if util.DirExists(mirrorPath) {
-		log.Debug("Mirror found at '%s'.\n", mirrorPath)
-		return &TarMirror{path: mirrorPath}, nil
+		if util.FileExists(mirror.archivePath()) {
+			logger.Debug("Mirror found at '%s'.\n", mirrorPath)
+			recordMirrorUsage(mirrorPath, url, logger)
+			return mirror, nil
+		}
+		// Mirrors created by older versions of dbt do not keep the archive, so their content
+		// cannot be verified.
+		logger.Debug("Mirror at '%s' does not contain the archive. Removing it.\n", mirrorPath)
+		if err := os.RemoveAll(mirrorPath); err != nil {
+			return nil, err
+		}
+	}
+	if configuration.Offline {
+		logger.Debug("Not downloading mirror in offline mode.\n")
+		return nil, nil
 	}
 
-	util.MkdirAll(mirrorPath)
-	mod := TarModule{mirrorPath, nil}
-	if err := mod.download(url); err != nil {
+	if err := os.MkdirAll(mirrorPath, moduleDirMode); err != nil {
+		return nil, err
+	}
+	mod := TarModule{path: mirrorPath, logger: logger}
+	err = downloadArchive(url, mirror.archivePath(), logger)
+	if err == nil {
+		err = mod.extractArchive(url, mirror.archivePath(), moduleType, expectedHash)
+	}
+	if err != nil {
 		// If downloading fails, we remove the mirror path to leave a clean tree so that the
 		// operation can be retried.
-		util.RemoveDir(mod.path)
+		os.RemoveAll(mod.path)
+		os.Remove(mirror.archivePath())
 		return nil, err
 	}
-	log.Debug("Mirror downloaded at '%s'.\n", mirrorPath)
+	logger.Debug("Mirror downloaded at '%s'.\n", mirrorPath)
+	recordMirrorUsage(mirrorPath, url, logger)
+
+	return mirror, nil
+}
+
+// Path returns the path of the mirror directory.
+func (m *TarMirror) Path() string {
+	return m.path
+}
 
-	return &TarMirror{path: mirrorPath}, nil
+// archivePath returns the path of the archive that the mirror directory was extracted from.
+func (m *TarMirror) archivePath() string {
+	return m.path + tarMirrorArchiveSuffix
+}
+
+// Update does nothing on TarMirrors. An archive only ever has a single version.
+func (m *TarMirror) Update() error {
+	return nil
+}
+
+// RevParse returns the hash of the mirrored archive, which is the only version of a TarModule.
+func (m *TarMirror) RevParse(rev string) (string, error) {
+	return m.module().Head(), nil
+}
+
+func (m *TarMirror) IsAncestor(ancestor, rev string) bool {
+	return true
+}
+
+// HasRevision returns whether the mirrored archive has the hash `hash`.
+func (m *TarMirror) HasRevision(hash string) bool {
+	return m.module().Head() == hash
+}
+
+// ReadModuleFile reads the MODULE file of the mirrored archive.
+func (m *TarMirror) ReadModuleFile(hash string) (ModuleFile, error) {
+	if !m.HasRevision(hash) {
+		return ModuleFile{}, fmt.Errorf("mirror '%s' does not contain version '%s'", m.path, hash)
+	}
+	return ReadModuleFile(m.path), nil
+}
+
+func (m *TarMirror) module() TarModule {
+	return TarModule{path: m.path}
 }
 
 // createTarModule creates a new TarModule in the given `modulePath` by downloading
-// and extracting the TAR archive reference by `url`. The origin of the module
+// and extracting the archive reference by `url`. The origin of the module
 // (i.e., the download url) is stored in a ".metadata" file inside the module directory.
-func createTarModule(modulePath, url string) (Module, error) {
-	mirror, err := getOrCreateTarMirror(url)
+// If `expectedHash` is not empty, the archive is only extracted if it has that hash.
+// The module prints all messages to `logger`.
+func createTarModule(modulePath, url string, moduleType ModuleType, expectedHash string, logger *log.Logger) (Module, error) {
+	mirror, err := getOrCreateTarMirror(url, moduleType, expectedHash, logger)
 	if err != nil {
 		return nil, err
 	}
 
-	module := TarModule{path: modulePath, mirror: mirror}
-	err = module.clone(url)
+	module := TarModule{path: modulePath, mirror: mirror, logger: logger}
+	err = module.clone(url, moduleType, expectedHash)
 	if err != nil {
 		return nil, err
 	}
@@ -142,9 +245,14 @@ func (m TarModule) IsAncestor(ancestor, rev string) bool {
 	return true
 }
 
+// HasRevision returns whether the archive has the hash `hash`.
+func (m TarModule) HasRevision(hash string) bool {
+	return m.Head() == hash
+}
+
 // Fetch does nothing on TarModules and reports that no changes have been fetched.
-func (m TarModule) Fetch() bool {
-	return false
+func (m TarModule) Fetch() (bool, error) {
+	return false, nil
 }
 
 // Checkout changes the module's current version to `ref`.
@@ -157,37 +265,78 @@ func (m TarModule) Checkout(hash string) {
 }
 
 func (m TarModule) Type() ModuleType {
-	return TarGzModuleType
+	var metadata metadataFile
+	util.ReadYaml(path.Join(m.path, tarMetadataFileName), &metadata)
+	return metadata.moduleType()
 }
 
 // clones a tar from either a mirror (if the tar module contains one and is valid) or downloaded from
 // the network
-func (m TarModule) clone(url string) error {
+func (m TarModule) clone(url string, moduleType ModuleType, expectedHash string) error {
 	// Check if it is available already in the mirror
 	if m.mirror != nil {
-		// Validate the mirror by making sure the metadata path is present
-		metdata_path := path.Join(m.mirror.path, tarMetadataFileName)
-		if util.FileExists(metdata_path) {
-			err := util.CopyDirRecursively(m.mirror.path, m.path)
-			return err
+		// The mirrored archive is verified against the pinned hash or, if there is none, against
+		// the hash recorded when the mirror was created.
+		mirrorHash := expectedHash
+		if mirrorHash == "" {
+			var metadata metadataFile
+			if err := readMetadataFile(path.Join(m.mirror.path, tarMetadataFileName), &metadata); err != nil {
+				return fmt.Errorf("failed to read the metadata of mirror '%s': %s", m.mirror.path, err)
+			}
+			mirrorHash = metadata.Sha256
 		}
+		if err := m.extractArchive(url, m.mirror.archivePath(), moduleType, mirrorHash); err != nil {
+			return fmt.Errorf("failed to extract mirror '%s': %s", m.mirror.path, err)
+		}
+		return nil
+	}
+
+	if config.GetConfig().Offline {
+		return fmt.Errorf("'%s' is not available in the mirror in offline mode", url)
 	}
 
 	// Mirror not available download instead
-	return m.download(url)
+	archive, err := os.CreateTemp("", "dbt-archive-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %s", err)
+	}
+	archive.Close()
+	defer os.Remove(archive.Name())
+
+	if err := downloadArchive(url, archive.Name(), m.logger); err != nil {
+		return err
+	}
+	return m.extractArchive(url, archive.Name(), moduleType, expectedHash)
 }
 
-// Downloads a tar.gz gziped archive from the provided url
-func (m TarModule) download(url string) error {
-	log.Log("Downloading '%s'.\n", url)
+// Downloads the archive from the provided url into the file `archivePath`. The url rewrites from the
+// configuration are applied to `url`. All messages are printed to `logger`.
+func downloadArchive(url, archivePath string, logger *log.Logger) error {
+	url = config.GetConfig().RewriteURL(url)
+	if localPath, isLocal := util.CutPrefix(url, localUrlPrefix); isLocal || path.IsAbs(url) {
+		logger.Log("Copying '%s'.\n", localPath)
+		if err := copyFile(localPath, archivePath, 0664); err != nil {
+			return fmt.Errorf("failed to copy archive: %s", err)
+		}
+		return nil
+	}
+
+	logger.Log("Downloading '%s'.\n", url)
+	return retryNetworkOperation(logger, fmt.Sprintf("Downloading '%s'", url), func(ctx context.Context) error {
+		return downloadFile(ctx, url, archivePath, logger)
+	})
+}
 
-	request, err := http.NewRequest("GET", url, nil)
+// Downloads the file at the http(s) url `url` into the file `filePath`. Errors that are not
+// resolved by downloading the file again are permanent errors.
+func downloadFile(ctx context.Context, url, filePath string, logger *log.Logger) error {
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return fmt.Errorf("failed to construct HTTP request to download archive: %s", err)
+		return permanentError{fmt.Errorf("failed to construct HTTP request to download archive: %s", err)}
 	}
 
 	if auth := netrc.GetAuthForUrl(url); auth != nil {
-		log.Debug("Using netrc auth for url %q\n", url)
+		logger.Debug("Using netrc auth for url %q\n", url)
 		request.SetBasicAuth(auth.User, auth.Password)
 	}
 
@@ -197,16 +346,127 @@ func (m TarModule) download(url string) error {
 	}
 	defer response.Body.Close()
 
+	if response.StatusCode != http.StatusOK {
+		err := fmt.Errorf("failed to download archive: server responded with '%s'", response.Status)
+		// Server errors, timeouts and rate limits are usually transient.
+		if response.StatusCode >= 500 || response.StatusCode == http.StatusRequestTimeout || response.StatusCode == http.StatusTooManyRequests {
+			return err
+		}
+		return permanentError{err}
+	}
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return permanentError{fmt.Errorf("failed to create file: %s", err)}
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, response.Body); err != nil {
+		return fmt.Errorf("failed to download archive: %s", err)
+	}
+	return nil
+}
+
+// hashFile returns the hex encoded sha256 hash of the file `filePath`.
+func hashFile(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
 	hasher := sha256.New()
-	gzFile := io.TeeReader(response.Body, hasher)
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// Verifies that the archive `archivePath` has the hash `expectedHash` (unless it is empty) and
+// extracts the archive of type `moduleType` into the module directory.
+func (m TarModule) extractArchive(url, archivePath string, moduleType ModuleType, expectedHash string) error {
+	hash, err := hashFile(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to hash archive: %s", err)
+	}
+	if expectedHash != "" && hash != expectedHash {
+		return fmt.Errorf("archive '%s' has hash '%s', but hash '%s' was expected. Refusing to extract it", url, hash, expectedHash)
+	}
 
-	tarFile, err := gzip.NewReader(gzFile)
+	archive, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %s", err)
+	}
+	defer archive.Close()
+
+	if moduleType == ZipModuleType {
+		err = m.extractZip(archive)
+	} else {
+		err = m.extractTar(archive, moduleType)
+	}
+	if err != nil {
+		return err
+	}
+
+	metadata := metadataFile{URL: url, Sha256: hash}
+	if moduleType != TarGzModuleType {
+		metadata.Type = moduleType.String()
+	}
+	return writeMetadataFile(path.Join(m.path, tarMetadataFileName), metadata)
+}
+
+// decompress wraps `archive` in a reader that decompresses a tar archive of type `moduleType`.
+func decompress(archive io.Reader, moduleType ModuleType) (io.Reader, func(), error) {
+	switch moduleType {
+	case TarGzModuleType:
+		reader, err := gzip.NewReader(archive)
+		return reader, func() {}, err
+	case TarXzModuleType:
+		reader, err := xz.NewReader(archive)
+		return reader, func() {}, err
+	case TarBz2ModuleType:
+		return bzip2.NewReader(archive), func() {}, nil
+	case TarZstModuleType:
+		reader, err := zstd.NewReader(archive)
+		if err != nil {
+			return nil, nil, err
+		}
+		return reader, reader.Close, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported archive type '%s'", moduleType)
+}
+
+// archiveRoot ensures that all entries of an archive are inside a single root directory.
+type archiveRoot struct {
+	name string
+}
+
+func (r *archiveRoot) check(name string, isDir bool) error {
+	if path.IsAbs(name) {
+		return fmt.Errorf("failed to decompress: archive can't have entries with absolute paths")
+	}
+	entryRoot := getRoot(name)
+	if !isDir && entryRoot == name {
+		return fmt.Errorf("failed to decompress: archive can't have files outside root directory")
+	}
+	if r.name == "" {
+		r.name = entryRoot
+	} else if r.name != entryRoot {
+		return fmt.Errorf("failed to decompress: archive can't have more than one root directory")
+	}
+	return nil
+}
+
+// Extracts a tar archive compressed with the compression of `moduleType`
+func (m TarModule) extractTar(archive io.Reader, moduleType ModuleType) error {
+	tarFile, closeTarFile, err := decompress(archive, moduleType)
 	if err != nil {
 		return fmt.Errorf("failed to decompress: %s", err)
 	}
+	defer closeTarFile()
 
 	tarReader := tar.NewReader(tarFile)
-	tarRootDir := ""
+	root := archiveRoot{}
 	for {
 		header, err := tarReader.Next()
 
@@ -226,14 +486,8 @@ func (m TarModule) download(url string) error {
 			return fmt.Errorf("failed to decompress: archive can't have device or fifo nodes")
 		}
 
-		headerRootDir := getRoot(header.Name)
-		if header.Typeflag != tar.TypeDir && headerRootDir == header.Name {
-			return fmt.Errorf("failed to decompress: archive can't have files outside root directory")
-		}
-		if tarRootDir == "" {
-			tarRootDir = headerRootDir
-		} else if tarRootDir != headerRootDir {
-			return fmt.Errorf("failed to decompress: archive can't have more than one root directory")
+		if err := root.check(header.Name, header.Typeflag == tar.TypeDir); err != nil {
+			return err
 		}
 
 		// We can't assume that tarReader visits a dir before the files inside it, although this is true most of the time.
@@ -241,62 +495,190 @@ func (m TarModule) download(url string) error {
 		// When we eventually visit it, we set the correct mode
 		switch header.Typeflag {
 		case tar.TypeDir:
-			dirPath := path.Join(m.path, stripRoot(header.Name))
-			log.Debug("Creating directory '%s'.\n", dirPath)
-			if err := os.MkdirAll(dirPath, os.FileMode(header.Mode)); err != nil {
-				return fmt.Errorf("failed to create directory: %s", err)
-			}
-			// We need this again because if the dir already existed os.MkdirAll does nothing
-			if err := os.Chmod(dirPath, os.FileMode(header.Mode)); err != nil {
-				return fmt.Errorf("failed to change filemode: %s", err)
+			if err := m.createDir(header.Name, os.FileMode(header.Mode)); err != nil {
+				return err
 			}
 		case tar.TypeReg:
-			filePath := path.Join(m.path, stripRoot(header.Name))
-			if err := os.MkdirAll(path.Dir(filePath), defaultDirMode); err != nil {
-				return fmt.Errorf("failed to create directory: %s", err)
+			if err := m.createFile(header.Name, os.FileMode(header.Mode), tarReader); err != nil {
+				return err
 			}
-			log.Debug("Creating file '%s'.\n", filePath)
-			file, err := os.Create(filePath)
-			if err != nil {
-				return fmt.Errorf("failed to create file: %s", err)
+		case tar.TypeLink:
+			if getRoot(header.Linkname) != root.name {
+				return fmt.Errorf("failed to decompress: archive can't have more than one root directory")
 			}
-			_, err = io.Copy(file, tarReader)
-			file.Close()
+			oldname, err := m.entryPath(header.Linkname)
 			if err != nil {
-				return fmt.Errorf("failed to write file: %s", err)
-			}
-			if err := os.Chmod(filePath, os.FileMode(header.Mode)); err != nil {
-				return fmt.Errorf("failed to change filemode: %s", err)
+				return err
 			}
-		case tar.TypeLink:
-			if getRoot(header.Linkname) != tarRootDir {
-				return fmt.Errorf("failed to decompress: archive can't have more than one root directory")
+			newname, err := m.entryPath(header.Name)
+			if err != nil {
+				return err
 			}
-			oldname := path.Join(m.path, stripRoot(header.Linkname))
-			newname := path.Join(m.path, stripRoot(header.Name))
 			if err := os.MkdirAll(path.Dir(newname), defaultDirMode); err != nil {
 				return fmt.Errorf("failed to create directory: %s", err)
 			}
-			log.Debug("Creating link from '%s' to '%s'.\n", newname, oldname)
+			m.logger.Debug("Creating link from '%s' to '%s'.\n", newname, oldname)
 			if err = os.Link(oldname, newname); err != nil {
 				return fmt.Errorf("failed to create link: %s", err)
 			}
 		case tar.TypeSymlink:
-			newname := path.Join(m.path, stripRoot(header.Name))
-			if err := os.MkdirAll(path.Dir(newname), defaultDirMode); err != nil {
-				return fmt.Errorf("failed to create directory: %s", err)
-			}
-			log.Debug("Creating symlink from '%s' to '%s'.\n", newname, header.Linkname)
-			if err := os.Symlink(header.Linkname, newname); err != nil {
-				return fmt.Errorf("failed to create symlink: %s", err)
+			if err := m.createSymlink(header.Name, header.Linkname); err != nil {
+				return err
 			}
 
 		default:
 			return fmt.Errorf("unknown tar type flag %d for entry '%s'", header.Typeflag, header.Name)
 		}
 	}
+	return nil
+}
+
+// Extracts a zip archive
+func (m TarModule) extractZip(archive *os.File) error {
+	info, err := archive.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to decompress: %s", err)
+	}
+
+	zipReader, err := zip.NewReader(archive, info.Size())
+	if err != nil {
+		return fmt.Errorf("failed to decompress: %s", err)
+	}
+
+	root := archiveRoot{}
+	for _, entry := range zipReader.File {
+		mode := entry.Mode()
+		if mode&(os.ModeDevice|os.ModeCharDevice|os.ModeNamedPipe|os.ModeSocket) != 0 {
+			return fmt.Errorf("failed to decompress: archive can't have device or fifo nodes")
+		}
+
+		if err := root.check(entry.Name, mode.IsDir()); err != nil {
+			return err
+		}
+
+		content, err := entry.Open()
+		if err != nil {
+			return fmt.Errorf("failed to decompress: %s", err)
+		}
+		switch {
+		case mode.IsDir():
+			err = m.createDir(entry.Name, mode.Perm())
+		case mode&os.ModeSymlink != 0:
+			var target []byte
+			if target, err = io.ReadAll(content); err == nil {
+				err = m.createSymlink(entry.Name, string(target))
+			}
+		default:
+			err = m.createFile(entry.Name, mode.Perm(), content)
+		}
+		content.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entryPath returns the path that the archive entry `name` is extracted to. Entries that would be
+// written outside of the module directory, either directly or through a symlink, are rejected.
+func (m TarModule) entryPath(name string) (string, error) {
+	modulePath := path.Clean(m.path)
+	entryPath := path.Join(modulePath, stripRoot(name))
+	if entryPath != modulePath && !strings.HasPrefix(entryPath, modulePath+"/") {
+		return "", fmt.Errorf("failed to decompress: archive entry '%s' escapes the module directory", name)
+	}
+
+	// Parent directories created by earlier entries must not be symlinks. Otherwise an archive
+	// could write anywhere on disk by extracting a file through a symlink.
+	for p := entryPath; p != modulePath; p = path.Dir(p) {
+		if info, err := os.Lstat(p); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("failed to decompress: archive entry '%s' would be written through the symlink '%s'", name, p)
+		}
+	}
+	return entryPath, nil
+}
+
+// checkSymlinkTarget rejects symlinks whose target is an absolute path or is outside of the module
+// directory, unless the 'allow-unsafe-symlinks' option is set in the configuration.
+func (m TarModule) checkSymlinkTarget(name, linkPath, target string) error {
+	if config.GetConfig().AllowUnsafeSymlinks {
+		return nil
+	}
+	if path.IsAbs(target) {
+		return fmt.Errorf("failed to decompress: symlink '%s' has the absolute target '%s'", name, target)
+	}
+
+	// Only leading '..' components are allowed. A '..' component following a symlink would be
+	// resolved relative to the symlink target, so it cannot be checked by looking at the path.
+	components := strings.Split(target, "/")
+	for idx, component := range components {
+		if component == ".." && idx > 0 && components[idx-1] != ".." {
+			return fmt.Errorf("failed to decompress: symlink '%s' has the target '%s' with a non-leading '..' component", name, target)
+		}
+	}
+
+	modulePath := path.Clean(m.path)
+	resolved := path.Join(path.Dir(linkPath), target)
+	if resolved != modulePath && !strings.HasPrefix(resolved, modulePath+"/") {
+		return fmt.Errorf("failed to decompress: symlink '%s' points to '%s' outside of the module directory", name, target)
+	}
+	return nil
+}
+
+func (m TarModule) createDir(name string, mode os.FileMode) error {
+	dirPath, err := m.entryPath(name)
+	if err != nil {
+		return err
+	}
+	m.logger.Debug("Creating directory '%s'.\n", dirPath)
+	if err := os.MkdirAll(dirPath, mode); err != nil {
+		return fmt.Errorf("failed to create directory: %s", err)
+	}
+	// We need this again because if the dir already existed os.MkdirAll does nothing
+	if err := os.Chmod(dirPath, mode); err != nil {
+		return fmt.Errorf("failed to change filemode: %s", err)
+	}
+	return nil
+}
 
-	metadata := metadataFile{url, hex.EncodeToString(hasher.Sum(nil))}
-	util.WriteYaml(path.Join(m.path, tarMetadataFileName), metadata)
+func (m TarModule) createFile(name string, mode os.FileMode, content io.Reader) error {
+	filePath, err := m.entryPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(filePath), defaultDirMode); err != nil {
+		return fmt.Errorf("failed to create directory: %s", err)
+	}
+	m.logger.Debug("Creating file '%s'.\n", filePath)
+	file, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %s", err)
+	}
+	_, err = io.Copy(file, content)
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write file: %s", err)
+	}
+	if err := os.Chmod(filePath, mode); err != nil {
+		return fmt.Errorf("failed to change filemode: %s", err)
+	}
+	return nil
+}
+
+func (m TarModule) createSymlink(name string, target string) error {
+	newname, err := m.entryPath(name)
+	if err != nil {
+		return err
+	}
+	if err := m.checkSymlinkTarget(name, newname, target); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(newname), defaultDirMode); err != nil {
+		return fmt.Errorf("failed to create directory: %s", err)
+	}
+	m.logger.Debug("Creating symlink from '%s' to '%s'.\n", newname, target)
+	if err := os.Symlink(target, newname); err != nil {
+		return fmt.Errorf("failed to create symlink: %s", err)
+	}
 	return nil
 }
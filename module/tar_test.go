@@ -0,0 +1,264 @@
+package module
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/daedaleanai/dbt/v3/config"
+)
+
+type testEntry struct {
+	name     string
+	typeflag byte
+	linkname string
+	content  string
+}
+
+func makeTarGz(t *testing.T, entries []testEntry) *bytes.Buffer {
+	archive := &bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(archive)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, entry := range entries {
+		header := &tar.Header{
+			Name:     entry.name,
+			Typeflag: entry.typeflag,
+			Linkname: entry.linkname,
+			Mode:     0644,
+			Size:     int64(len(entry.content)),
+		}
+		if entry.typeflag == tar.TypeDir {
+			header.Mode = 0755
+		}
+		if entry.typeflag != tar.TypeReg {
+			header.Size = 0
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Size > 0 {
+			if _, err := tarWriter.Write([]byte(entry.content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return archive
+}
+
+func makeZip(t *testing.T, entries []testEntry) *os.File {
+	file, err := os.Create(path.Join(t.TempDir(), "archive.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+
+	zipWriter := zip.NewWriter(file)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name}
+		content := entry.content
+		switch entry.typeflag {
+		case tar.TypeDir:
+			header.Name += "/"
+			header.SetMode(os.ModeDir | 0755)
+		case tar.TypeSymlink:
+			header.SetMode(os.ModeSymlink | 0777)
+			content = entry.linkname
+		default:
+			header.SetMode(0644)
+		}
+		writer, err := zipWriter.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// extractTestArchives extracts `entries` both as a tar.gz and as a zip archive into new module directories
+// inside `dir` and returns the errors of both extractions.
+func extractTestArchives(t *testing.T, dir string, entries []testEntry) []error {
+	errs := []error{}
+
+	tarModule := TarModule{path: path.Join(dir, "tar", "module")}
+	errs = append(errs, tarModule.extractTar(makeTarGz(t, entries), TarGzModuleType))
+
+	zipEntries := []testEntry{}
+	for _, entry := range entries {
+		if entry.typeflag != tar.TypeLink {
+			zipEntries = append(zipEntries, entry)
+		}
+	}
+	zipModule := TarModule{path: path.Join(dir, "zip", "module")}
+	errs = append(errs, zipModule.extractZip(makeZip(t, zipEntries)))
+	return errs
+}
+
+func setAllowUnsafeSymlinks(t *testing.T, allow bool) {
+	previous := config.GetConfig().AllowUnsafeSymlinks
+	config.Override(func(c *config.Config) { c.AllowUnsafeSymlinks = allow })
+	t.Cleanup(func() {
+		config.Override(func(c *config.Config) { c.AllowUnsafeSymlinks = previous })
+	})
+}
+
+func TestExtractValidArchive(t *testing.T) {
+	setAllowUnsafeSymlinks(t, false)
+	dir := t.TempDir()
+	errs := extractTestArchives(t, dir, []testEntry{
+		{name: "root", typeflag: tar.TypeDir},
+		{name: "root/dir/file", typeflag: tar.TypeReg, content: "content"},
+		{name: "root/link", typeflag: tar.TypeSymlink, linkname: "dir/file"},
+		{name: "root/dir/parent", typeflag: tar.TypeSymlink, linkname: "../link"},
+		{name: "root/dir/self", typeflag: tar.TypeSymlink, linkname: "."},
+	})
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	for _, kind := range []string{"tar", "zip"} {
+		content, err := os.ReadFile(path.Join(dir, kind, "module", "dir", "parent"))
+		if err != nil {
+			t.Fatalf("%s: %s", kind, err)
+		}
+		if string(content) != "content" {
+			t.Fatalf("%s: unexpected content '%s'", kind, content)
+		}
+	}
+}
+
+func TestExtractRejectsMaliciousArchives(t *testing.T) {
+	setAllowUnsafeSymlinks(t, false)
+	tests := []struct {
+		name    string
+		entries []testEntry
+		err     string
+	}{
+		{
+			name: "path traversal",
+			entries: []testEntry{
+				{name: "root/../../evil", typeflag: tar.TypeReg, content: "evil"},
+			},
+			err: "escapes the module directory",
+		},
+		{
+			name: "nested path traversal",
+			entries: []testEntry{
+				{name: "root/dir/../../../evil", typeflag: tar.TypeReg, content: "evil"},
+			},
+			err: "escapes the module directory",
+		},
+		{
+			name: "absolute path",
+			entries: []testEntry{
+				{name: "/tmp/evil", typeflag: tar.TypeReg, content: "evil"},
+			},
+			err: "absolute paths",
+		},
+		{
+			name: "absolute symlink",
+			entries: []testEntry{
+				{name: "root/link", typeflag: tar.TypeSymlink, linkname: "/etc"},
+			},
+			err: "absolute target",
+		},
+		{
+			name: "escaping symlink",
+			entries: []testEntry{
+				{name: "root/dir/link", typeflag: tar.TypeSymlink, linkname: "../../.."},
+			},
+			err: "outside of the module directory",
+		},
+		{
+			name: "non-leading parent component in symlink",
+			entries: []testEntry{
+				{name: "root/self", typeflag: tar.TypeSymlink, linkname: "."},
+				{name: "root/link", typeflag: tar.TypeSymlink, linkname: "self/../evil"},
+			},
+			err: "non-leading '..' component",
+		},
+		{
+			name: "file written through symlink",
+			entries: []testEntry{
+				{name: "root/dir", typeflag: tar.TypeDir},
+				{name: "root/link", typeflag: tar.TypeSymlink, linkname: "dir"},
+				{name: "root/link/file", typeflag: tar.TypeReg, content: "evil"},
+			},
+			err: "written through the symlink",
+		},
+		{
+			name: "escaping hard link",
+			entries: []testEntry{
+				{name: "root/file", typeflag: tar.TypeLink, linkname: "root/../../../etc/passwd"},
+			},
+			err: "escapes the module directory",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			hasHardLink := false
+			for _, entry := range test.entries {
+				hasHardLink = hasHardLink || entry.typeflag == tar.TypeLink
+			}
+
+			errs := extractTestArchives(t, dir, test.entries)
+			for idx, kind := range []string{"tar", "zip"} {
+				if kind == "zip" && hasHardLink {
+					// Zip archives have no hard links.
+					continue
+				}
+				if errs[idx] == nil || !strings.Contains(errs[idx].Error(), test.err) {
+					t.Fatalf("%s: expected error containing '%s', got '%v'", kind, test.err, errs[idx])
+				}
+				if _, err := os.Lstat(path.Join(dir, kind, "evil")); err == nil {
+					t.Fatalf("%s: archive was extracted outside of the module directory", kind)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractAllowUnsafeSymlinks(t *testing.T) {
+	setAllowUnsafeSymlinks(t, true)
+	dir := t.TempDir()
+	errs := extractTestArchives(t, dir, []testEntry{
+		{name: "root/absolute", typeflag: tar.TypeSymlink, linkname: "/etc"},
+		{name: "root/outside", typeflag: tar.TypeSymlink, linkname: "../.."},
+	})
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	// Writing through symlinks is never allowed.
+	errs = extractTestArchives(t, t.TempDir(), []testEntry{
+		{name: "root/outside", typeflag: tar.TypeSymlink, linkname: "../.."},
+		{name: "root/outside/evil", typeflag: tar.TypeReg, content: "evil"},
+	})
+	for _, err := range errs {
+		if err == nil || !strings.Contains(err.Error(), "written through the symlink") {
+			t.Fatalf("expected error about writing through a symlink, got '%v'", err)
+		}
+	}
+}
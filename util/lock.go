@@ -0,0 +1,63 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/daedaleanai/dbt/v3/log"
+)
+
+// FileLock is an exclusive advisory lock on a file that is shared between processes.
+type FileLock struct {
+	file *os.File
+}
+
+// LockFile acquires an exclusive lock on the file `lockPath`, creating the file and its directory
+// if necessary. If the lock is held by another process, `waitMessage` is printed and LockFile blocks
+// until the lock is released.
+func LockFile(lockPath string, waitMessage string) (*FileLock, error) {
+	if err := os.MkdirAll(filepath.Dir(lockPath), dirMode); err != nil {
+		return nil, fmt.Errorf("failed to create directory of lock file '%s': %w", lockPath, err)
+	}
+	file, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, fileMode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file '%s': %w", lockPath, err)
+	}
+
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		log.Log("%s", waitMessage)
+		err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to lock '%s': %w", lockPath, err)
+	}
+	log.Debug("Acquired lock '%s'.\n", lockPath)
+	return &FileLock{file}, nil
+}
+
+// Unlock releases the lock. Locks are also released when the process exits.
+func (l *FileLock) Unlock() {
+	log.Debug("Releasing lock '%s'.\n", l.file.Name())
+	syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+	l.file.Close()
+}
+
+// LockWorkspace acquires the lock that prevents multiple dbt processes from changing the
+// DEPS/ and BUILD/ directories of the workspace at the same time.
+func LockWorkspace(workspaceRoot string) *FileLock {
+	depsDir := filepath.Join(workspaceRoot, DepsDirName)
+	if err := os.MkdirAll(depsDir, dirMode); err != nil {
+		log.Fatal("Failed to create special directory %s: %v.\n", DepsDirName, err)
+	}
+
+	lock, err := LockFile(filepath.Join(depsDir, LockFileName), "Waiting for another dbt process to finish in this workspace...\n")
+	if err != nil {
+		log.Fatal("Failed to lock the workspace: %s.\n", err)
+	}
+	return lock
+}
@@ -26,11 +26,15 @@ import (
 const (
 	ModuleFileName      = "MODULE"
 	ModuleSyntaxVersion = 3
+	// LocalModuleFileName is the name of the untracked file holding workspace-local overrides.
+	LocalModuleFileName = "MODULE.local"
 
 	BuildDirName = "BUILD"
 	// DepsDirName is directory that dependencies are stored in.
 	DepsDirName     = "DEPS"
 	WarningFileName = "WARNING.readme.txt"
+	// LockFileName is the name of the file in the DEPS/ directory that guards the workspace.
+	LockFileName = ".lock"
 )
 
 const (